@@ -3,16 +3,20 @@ package nginx
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"regexp"
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/Masterminds/semver"
+	"github.com/paketo-buildpacks/nginx/nginxconf"
 	"github.com/paketo-buildpacks/packit/v2"
 	"github.com/paketo-buildpacks/packit/v2/cargo"
 	"github.com/paketo-buildpacks/packit/v2/chronos"
 	"github.com/paketo-buildpacks/packit/v2/draft"
+	"github.com/paketo-buildpacks/packit/v2/fs"
 	"github.com/paketo-buildpacks/packit/v2/postal"
 	"github.com/paketo-buildpacks/packit/v2/sbom"
 	"github.com/paketo-buildpacks/packit/v2/scribe"
@@ -40,11 +44,17 @@ type SBOMGenerator interface {
 	GenerateFromDependency(dependency postal.Dependency, dir string) (sbom.SBOM, error)
 }
 
+//go:generate faux --interface Precompressor --output fakes/precompressor.go
+type Precompressor interface {
+	Precompress(root, cachePath string, brotli bool) (PrecompressResult, error)
+}
+
 func Build(config Configuration,
 	dependencyService DependencyService,
 	configGenerator ConfigGenerator,
 	calculator Calculator,
 	sbomGenerator SBOMGenerator,
+	precompressor Precompressor,
 	logger scribe.Emitter,
 	clock chronos.Clock,
 ) packit.BuildFunc {
@@ -69,6 +79,20 @@ func Build(config Configuration,
 
 		logger.SelectedDependency(entry, dependency, clock.Now())
 
+		var modules []postal.Dependency
+		for _, name := range config.NGINXModules {
+			module, err := dependencyService.Resolve(filepath.Join(context.CNBPath, "buildpack.toml"), ModuleDependencyPrefix+name, dependency.Version, context.Stack)
+			if err != nil {
+				return packit.BuildResult{}, fmt.Errorf("module %q (BP_NGINX_MODULES) is not available for nginx %s: %w", name, dependency.Version, err)
+			}
+
+			modules = append(modules, module)
+		}
+
+		if config.NGINXMetricsExporter && config.NGINXStubStatusPort == "" {
+			return packit.BuildResult{}, errors.New("BP_NGINX_METRICS_EXPORTER requires BP_NGINX_STUB_STATUS_PORT to be set")
+		}
+
 		versionSource, _ := entry.Metadata["version-source"].(string)
 		if versionSource == "buildpack.yml" {
 			nextMajorVersion := semver.MustParse(context.BuildpackInfo.Version).IncMajor()
@@ -81,7 +105,36 @@ func Build(config Configuration,
 			config.NGINXConfLocation = filepath.Join(context.WorkingDir, config.NGINXConfLocation)
 		}
 
+		webServerRoot := config.WebServerRoot
+		if !filepath.IsAbs(webServerRoot) {
+			webServerRoot = filepath.Join(context.WorkingDir, webServerRoot)
+		}
+
 		if config.WebServer == "nginx" {
+			for _, page := range []struct{ path, env string }{
+				{config.WebServerErrorPage404, "BP_WEB_SERVER_ERROR_PAGE_404"},
+				{config.WebServerErrorPage5xx, "BP_WEB_SERVER_ERROR_PAGE_5XX"},
+			} {
+				if page.path == "" {
+					continue
+				}
+
+				_, err := os.Stat(filepath.Join(webServerRoot, filepath.Clean("/"+page.path)))
+				if err != nil && errors.Is(err, os.ErrNotExist) {
+					return packit.BuildResult{}, fmt.Errorf("file %s (%s) doesn't exist within web server root", page.path, page.env)
+				}
+			}
+
+			config.Redirects, err = loadRules(context.WorkingDir, webServerRoot, RedirectsFile, ParseRedirects)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			config.Headers, err = loadRules(context.WorkingDir, webServerRoot, HeadersFile, ParseHeaders)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
 			err = configGenerator.Generate(config)
 			if err != nil {
 				return packit.BuildResult{}, fmt.Errorf("failed to generate nginx.conf : %w", err)
@@ -96,28 +149,93 @@ func Build(config Configuration,
 			}
 		}
 
+		var otherLayers []packit.Layer
+		if config.WebServerPrecompress {
+			if _, err := os.Stat(webServerRoot); err != nil {
+				return packit.BuildResult{}, fmt.Errorf("failed to precompress assets: web server root %s (BP_WEB_SERVER_ROOT) doesn't exist within app dir", config.WebServerRoot)
+			}
+
+			assetsLayer, err := context.Layers.Get(PrecompressedAssets)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+			assetsLayer.Cache = true
+
+			logger.Process("Precompressing static assets in %s", webServerRoot)
+			var result PrecompressResult
+			duration, err := clock.Measure(func() error {
+				result, err = precompressor.Precompress(webServerRoot, assetsLayer.Path, config.WebServerPrecompressBrotli)
+				return err
+			})
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			logger.Subprocess("Compressed %d file(s), reused %d cached file(s)", result.Compressed, result.Reused)
+			logger.Action("Completed in %s", duration.Round(time.Millisecond))
+			logger.Break()
+
+			otherLayers = append(otherLayers, assetsLayer)
+		}
+
 		var hasNGINXConf bool
 		if _, err := os.Stat(config.NGINXConfLocation); err == nil {
 			hasNGINXConf = true
 		}
 
 		if hasNGINXConf {
-			confs, err := getIncludedConfs(config.NGINXConfLocation)
-			if err != nil {
-				return packit.BuildResult{}, fmt.Errorf("failed to find configuration files: %w", err)
+			var findings []LintFinding
+			confs, err := nginxconf.Resolve(config.NGINXConfLocation, filepath.Dir(config.NGINXConfLocation), os.ReadFile)
+			if err == nil {
+				// nginx runs with the runtime directory, which mirrors the app dir,
+				// as its prefix
+				findings = LintConfig(confs, context.WorkingDir, context.Layers.Path)
+			} else {
+				var parseErr *nginxconf.ParseError
+				if !errors.As(err, &parseErr) {
+					return packit.BuildResult{}, fmt.Errorf("failed to find configuration files: %w", err)
+				}
+
+				// nginx accepts some configurations that the parser doesn't, so they
+				// aren't checked and their included files are found by name instead
+				findings = append(findings, LintFinding{
+					File:     parseErr.File,
+					Line:     parseErr.Line,
+					Severity: LintWarning,
+					Message:  fmt.Sprintf("%s; the configuration can't be checked", parseErr.Err),
+				})
+
+				confs, err = nginxconf.ResolveByName(config.NGINXConfLocation, filepath.Dir(config.NGINXConfLocation), os.ReadFile)
+				if err != nil {
+					return packit.BuildResult{}, fmt.Errorf("failed to find configuration files: %w", err)
+				}
 			}
 
-			for _, path := range append([]string{config.NGINXConfLocation}, confs...) {
-				info, err := os.Stat(path)
+			for _, conf := range confs {
+				// Included files outside of the app dir, such as system-wide
+				// mime.types, aren't templates and aren't ours to change
+				rel, err := filepath.Rel(context.WorkingDir, conf.Path)
+				if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+					continue
+				}
+
+				info, err := os.Stat(conf.Path)
 				if err != nil {
 					return packit.BuildResult{}, fmt.Errorf("failed to stat configuration files: %w", err)
 				}
 
-				err = os.Chmod(path, info.Mode()|0060)
+				// The configure exec.d binary reads the templates at launch, possibly
+				// as a different user of the same group
+				err = os.Chmod(conf.Path, info.Mode()|0040)
 				if err != nil {
 					return packit.BuildResult{}, fmt.Errorf("failed to chmod configuration files: %w", err)
 				}
 			}
+
+			err = lintConfig(findings, config, context.WorkingDir, logger)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
 		}
 
 		layer, err := context.Layers.Get(NGINX)
@@ -125,9 +243,19 @@ func Build(config Configuration,
 			return packit.BuildResult{}, err
 		}
 
-		bom := dependencyService.GenerateBillOfMaterials(dependency)
+		bom := dependencyService.GenerateBillOfMaterials(append([]postal.Dependency{dependency}, modules...)...)
 		launch, build := planner.MergeLayerTypes("nginx", context.Plan.Entries)
 
+		if len(modules) > 0 {
+			modulesLayer, err := installModules(context, config.NGINXModules, modules, dependencyService, logger, clock)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			modulesLayer.Launch, modulesLayer.Build = launch, build
+			otherLayers = append(otherLayers, modulesLayer)
+		}
+
 		var buildMetadata packit.BuildMetadata
 		if build {
 			buildMetadata.BOM = bom
@@ -135,17 +263,36 @@ func Build(config Configuration,
 
 		var launchMetadata packit.LaunchMetadata
 		if launch && hasNGINXConf {
+			rel, err := filepath.Rel(context.WorkingDir, config.NGINXConfLocation)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+				return packit.BuildResult{}, fmt.Errorf("file %s (BP_NGINX_CONF_LOCATION) must be within app dir", config.NGINXConfLocation)
+			}
+
 			command := "nginx"
 			args := []string{
-				"-p", context.WorkingDir,
-				"-c", config.NGINXConfLocation,
+				"-p", RuntimeDir,
+				"-c", filepath.Join(RuntimeDir, rel),
 				"-g", "pid /tmp/nginx.pid;",
 			}
+
+			// nginx drops the requests in flight on the SIGTERM that stops the
+			// container, so the launcher turns it into SIGQUIT, which drains them
+			launcherLayer, err := installBinary(context, Launcher, "launcher", LauncherBinKey, calculator, logger)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			launcherLayer.Launch = true
+			otherLayers = append(otherLayers, launcherLayer)
+
+			launcherCommand := filepath.Join(launcherLayer.Path, "bin", "launcher")
+			launcherArgs := append([]string{command}, args...)
+
 			launchMetadata.Processes = []packit.Process{
 				{
 					Type:    "web",
-					Command: command,
-					Args:    args,
+					Command: launcherCommand,
+					Args:    launcherArgs,
 					Default: true,
 					Direct:  true,
 				},
@@ -153,6 +300,10 @@ func Build(config Configuration,
 			launchMetadata.BOM = bom
 
 			if config.LiveReloadEnabled {
+				// The templates are rendered once when the container starts, so the
+				// launcher runs the configure exec.d binary again on every restart
+				configure := filepath.Join(context.Layers.Path, NGINX, "exec.d", "0-configure")
+
 				launchMetadata.Processes = []packit.Process{
 					{
 						Type:    "web",
@@ -162,21 +313,39 @@ func Build(config Configuration,
 							"--watch", context.WorkingDir,
 							"--shell", "none",
 							"--",
-							command,
-						}, args...),
+							launcherCommand,
+							"--configure", configure,
+						}, launcherArgs...),
 						Default: true,
 						Direct:  true,
 					},
 					{
 						Type:    "no-reload",
-						Command: command,
-						Args:    args,
+						Command: launcherCommand,
+						Args:    launcherArgs,
 						Direct:  true,
 					},
 				}
 			}
 		}
 
+		if launch && config.NGINXMetricsExporter {
+			exporterLayer, err := installBinary(context, MetricsExporter, "exporter", ExporterBinKey, calculator, logger)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			exporterLayer.Launch = true
+			otherLayers = append(otherLayers, exporterLayer)
+
+			launchMetadata.Processes = append(launchMetadata.Processes, packit.Process{
+				Type:    "metrics",
+				Command: filepath.Join(exporterLayer.Path, "bin", "exporter"),
+				Args:    []string{"--stub-status-url", fmt.Sprintf("http://127.0.0.1:%s/stub_status", config.NGINXStubStatusPort)},
+				Direct:  true,
+			})
+		}
+
 		configureBinPath := filepath.Join(context.CNBPath, "bin", "configure")
 		currConfigureBinChecksum, err := calculator.Sum(configureBinPath)
 		if err != nil {
@@ -188,9 +357,10 @@ func Build(config Configuration,
 			logger.Break()
 
 			layer.Launch, layer.Build = launch, build
+			setRuntimeEnv(layer.LaunchEnv, config)
 
 			return packit.BuildResult{
-				Layers: []packit.Layer{layer},
+				Layers: append([]packit.Layer{layer}, otherLayers...),
 				Build:  buildMetadata,
 				Launch: launchMetadata,
 			}, nil
@@ -213,22 +383,34 @@ func Build(config Configuration,
 			return packit.BuildResult{}, err
 		}
 
+		logger.Action("Completed in %s", duration.Round(time.Millisecond))
+
+		available, err := nginxconf.Modules(filepath.Join(layer.Path, "modules"))
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		if len(available) > 0 {
+			logger.Subprocess("Available modules: %s", strings.Join(available, ", "))
+		}
+		logger.Break()
+
 		layer.Metadata = map[string]interface{}{
 			DepKey:          dependency.Checksum,
 			ConfigureBinKey: currConfigureBinChecksum,
+			ModulesKey:      available,
 		}
 
-		logger.Action("Completed in %s", duration.Round(time.Millisecond))
-		logger.Break()
-
 		layer.SharedEnv.Append("PATH", filepath.Join(layer.Path, "sbin"), string(os.PathListSeparator))
 		layer.LaunchEnv.Default("EXECD_CONF", config.NGINXConfLocation)
+		layer.LaunchEnv.Default("EXECD_RUNTIME_DIR", RuntimeDir)
 		layer.ExecD = []string{configureBinPath}
 
 		if config.WebServer == "nginx" {
 			layer.LaunchEnv.Default("APP_ROOT", context.WorkingDir)
 			layer.LaunchEnv.Default("PORT", "8080")
 		}
+		setRuntimeEnv(layer.LaunchEnv, config)
 
 		logger.EnvironmentVariables(layer)
 
@@ -254,13 +436,145 @@ func Build(config Configuration,
 		}
 
 		return packit.BuildResult{
-			Layers: []packit.Layer{layer},
+			Layers: append([]packit.Layer{layer}, otherLayers...),
 			Build:  buildMetadata,
 			Launch: launchMetadata,
 		}, nil
 	}
 }
 
+// installModules installs the module dependencies selected with
+// BP_NGINX_MODULES into a layer of their own, reusing it while their checksums
+// are the same, and records the names of the modules it provides. The
+// configure exec.d binary looks up the modules of the module template
+// function there.
+func installModules(context packit.BuildContext, names []string, modules []postal.Dependency, dependencyService DependencyService, logger scribe.Emitter, clock chronos.Clock) (packit.Layer, error) {
+	layer, err := context.Layers.Get(Modules)
+	if err != nil {
+		return packit.Layer{}, err
+	}
+
+	checksums := map[string]interface{}{}
+	for i, module := range modules {
+		checksums[names[i]] = module.Checksum
+	}
+
+	if reflect.DeepEqual(layer.Metadata["checksums"], checksums) {
+		logger.Process("Reusing cached layer %s", layer.Path)
+		logger.Break()
+
+		return layer, nil
+	}
+
+	logger.Process("Installing nginx modules")
+
+	layer, err = layer.Reset()
+	if err != nil {
+		return packit.Layer{}, err
+	}
+
+	for i, module := range modules {
+		logger.Subprocess("Installing %s %s", names[i], module.Version)
+		duration, err := clock.Measure(func() error {
+			return dependencyService.Deliver(module, context.CNBPath, layer.Path, context.Platform.Path)
+		})
+		if err != nil {
+			return packit.Layer{}, err
+		}
+
+		logger.Action("Completed in %s", duration.Round(time.Millisecond))
+	}
+
+	available, err := nginxconf.Modules(layer.Path)
+	if err != nil {
+		return packit.Layer{}, err
+	}
+
+	if len(available) > 0 {
+		logger.Subprocess("Available modules: %s", strings.Join(available, ", "))
+	}
+	logger.Break()
+
+	layer.Metadata = map[string]interface{}{
+		"checksums": checksums,
+		ModulesKey:  available,
+	}
+	layer.LaunchEnv.Default("EXECD_MODULES_DIR", layer.Path)
+
+	return layer, nil
+}
+
+// installBinary copies a binary of the buildpack into a layer of its own, as
+// the buildpack isn't part of the app image. The layer is reused as long as
+// the checksum of the binary, kept in the layer metadata under key, matches.
+func installBinary(context packit.BuildContext, layerName, binary, key string, calculator Calculator, logger scribe.Emitter) (packit.Layer, error) {
+	layer, err := context.Layers.Get(layerName)
+	if err != nil {
+		return packit.Layer{}, err
+	}
+
+	binPath := filepath.Join(context.CNBPath, "bin", binary)
+	checksum, err := calculator.Sum(binPath)
+	if err != nil {
+		return packit.Layer{}, fmt.Errorf("checksum failed for file %s: %w", binPath, err)
+	}
+
+	if prev, ok := layer.Metadata[key].(string); ok && cargo.Checksum(checksum).Match(cargo.Checksum(prev)) {
+		logger.Process("Reusing cached layer %s", layer.Path)
+		logger.Break()
+
+		return layer, nil
+	}
+
+	logger.Process("Installing the %s binary", binary)
+
+	layer, err = layer.Reset()
+	if err != nil {
+		return packit.Layer{}, err
+	}
+
+	err = os.MkdirAll(filepath.Join(layer.Path, "bin"), os.ModePerm)
+	if err != nil {
+		return packit.Layer{}, fmt.Errorf("failed to install %s: %w", binary, err)
+	}
+
+	err = fs.Copy(binPath, filepath.Join(layer.Path, "bin", binary))
+	if err != nil {
+		return packit.Layer{}, fmt.Errorf("failed to install %s: %w", binary, err)
+	}
+
+	logger.Break()
+
+	layer.Metadata = map[string]interface{}{
+		key: checksum,
+	}
+
+	return layer, nil
+}
+
+// setRuntimeEnv tells the configure exec.d binary where to write the
+// environment variables that should be exposed to the app at launch. The
+// variables are cleared when the feature is off, as a reused layer keeps the
+// environment of the previous build.
+func setRuntimeEnv(env packit.Environment, config Configuration) {
+	delete(env, "EXECD_RUNTIME_ENV_FILE.default")
+	delete(env, "EXECD_RUNTIME_ENV_PREFIX.default")
+
+	if config.WebServer != "nginx" || config.WebServerRuntimeEnvPrefix == "" {
+		return
+	}
+
+	env.Default("EXECD_RUNTIME_ENV_FILE", runtimeEnvPath(config))
+	env.Default("EXECD_RUNTIME_ENV_PREFIX", config.WebServerRuntimeEnvPrefix)
+}
+
+// runtimeEnvPath returns where the environment variables are written at
+// launch. The file lives in the runtime directory rather than the web server
+// root, which may be read-only, and the generated nginx.conf aliases it.
+func runtimeEnvPath(config Configuration) string {
+	return filepath.Join(RuntimeDir, "runtime-env", filepath.Clean("/"+config.WebServerRuntimeEnvFile))
+}
+
 func shouldInstall(layerMetadata map[string]interface{}, configBinChecksum, dependencyChecksum string) bool {
 	prevDepChecksum, depOk := layerMetadata[DepKey].(string)
 	prevBinChecksum, binOk := layerMetadata[ConfigureBinKey].(string)
@@ -279,30 +593,74 @@ func shouldInstall(layerMetadata map[string]interface{}, configBinChecksum, depe
 	return false
 }
 
-var IncludeConfRegexp = regexp.MustCompile(`include\s+(\S*.conf);`)
+// lintConfig reports the findings of LintConfig, failing the build on errors
+// and, if BP_NGINX_LINT_WARNINGS is "error", on warnings.
+func lintConfig(findings []LintFinding, config Configuration, workingDir string, logger scribe.Emitter) error {
+	mode := config.NGINXLintWarnings
+	if mode == "" {
+		mode = "warn"
+	}
 
-func getIncludedConfs(path string) ([]string, error) {
-	content, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("could not read config file (%s): %w", path, err)
+	if mode != "warn" && mode != "error" && mode != "off" {
+		return fmt.Errorf("invalid BP_NGINX_LINT_WARNINGS value %q: expected 'warn', 'error' or 'off'", mode)
 	}
 
-	var files []string
-	for _, match := range IncludeConfRegexp.FindAllStringSubmatch(string(content), -1) {
-		if len(match) == 2 {
-			glob := match[1]
-			if !filepath.IsAbs(glob) {
-				glob = filepath.Join(filepath.Dir(path), glob)
-			}
+	var reported []LintFinding
+	for _, finding := range findings {
+		if finding.Severity == LintWarning && mode == "off" {
+			continue
+		}
 
-			matches, err := filepath.Glob(glob)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get 'include' files for %s: %w", glob, err)
-			}
+		if rel, err := filepath.Rel(workingDir, finding.File); err == nil {
+			finding.File = rel
+		}
+
+		reported = append(reported, finding)
+	}
+
+	if len(reported) == 0 {
+		return nil
+	}
+
+	logger.Process("Checking nginx configuration")
+	failed := 0
+	for _, finding := range reported {
+		logger.Subprocess("%s", finding)
+		if finding.Severity == LintError || mode == "error" {
+			failed++
+		}
+	}
+	logger.Break()
 
-			files = append(files, matches...)
+	if failed > 0 {
+		return fmt.Errorf("nginx configuration check failed with %d problem(s), see the build log for details", failed)
+	}
+
+	return nil
+}
+
+// loadRules parses an optional rules file, like _redirects or _headers, from
+// the web server root. A missing file yields no rules.
+func loadRules[T any](workingDir, webServerRoot, filename string, parse func(string, io.Reader) ([]T, error)) ([]T, error) {
+	path := filepath.Join(webServerRoot, filename)
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
 		}
+
+		return nil, fmt.Errorf("failed to open %s: %w", filename, err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to close file: %v\n", err)
+		}
+	}()
+
+	name, err := filepath.Rel(workingDir, path)
+	if err != nil {
+		name = path
 	}
 
-	return files, nil
+	return parse(name, file)
 }
@@ -3,6 +3,7 @@ package nginx_test
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -36,6 +37,7 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		configGenerator   *fakes.ConfigGenerator
 		calculator        *fakes.Calculator
 		sbomGenerator     *fakes.SBOMGenerator
+		precompressor     *fakes.Precompressor
 
 		buffer *bytes.Buffer
 
@@ -81,8 +83,11 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		sbomGenerator = &fakes.SBOMGenerator{}
 		sbomGenerator.GenerateFromDependencyCall.Returns.SBOM = sbom.SBOM{}
 
+		precompressor = &fakes.Precompressor{}
+
 		Expect(os.Mkdir(filepath.Join(cnbPath, "bin"), os.ModePerm)).To(Succeed())
 		Expect(os.WriteFile(filepath.Join(cnbPath, "bin", "configure"), []byte("binary-contents"), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(cnbPath, "bin", "launcher"), []byte("launcher-contents"), 0700)).To(Succeed())
 
 		Expect(os.WriteFile(filepath.Join(workspaceDir, "nginx.conf"), []byte("worker_processes 2;"), 0600)).To(Succeed())
 
@@ -120,16 +125,24 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			configGenerator,
 			calculator,
 			sbomGenerator,
+			precompressor,
 			scribe.NewEmitter(buffer),
 			chronos.DefaultClock,
 		)
 	})
 
 	it("does a build", func() {
+		dependencyService.DeliverCall.Stub = func(dependency postal.Dependency, cnbPath, layerPath, platformPath string) error {
+			Expect(os.MkdirAll(filepath.Join(layerPath, "modules"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(layerPath, "modules", "ngx_stream_module.so"), nil, 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(layerPath, "modules", "ngx_http_image_filter_module.so"), nil, 0600)).To(Succeed())
+			return nil
+		}
+
 		result, err := build(buildContext)
 		Expect(err).NotTo(HaveOccurred())
 
-		Expect(len(result.Layers)).To(Equal(1))
+		Expect(len(result.Layers)).To(Equal(2))
 		layer := result.Layers[0]
 
 		Expect(layer.Name).To(Equal("nginx"))
@@ -142,14 +155,27 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			"PATH.delim":  ":",
 		}))
 		Expect(layer.LaunchEnv).To(Equal(packit.Environment{
-			"EXECD_CONF.default": filepath.Join(workspaceDir, nginx.ConfFile),
+			"EXECD_CONF.default":        filepath.Join(workspaceDir, nginx.ConfFile),
+			"EXECD_RUNTIME_DIR.default": nginx.RuntimeDir,
 		}))
 		Expect(layer.Metadata).To(Equal(map[string]interface{}{
 			nginx.DepKey:          "sha256:some-sha",
 			nginx.ConfigureBinKey: "some-bin-sha",
+			nginx.ModulesKey:      []string{"ngx_http_image_filter_module", "ngx_stream_module"},
 		}))
 		Expect(layer.ExecD).To(Equal([]string{filepath.Join(cnbPath, "bin", "configure")}))
 
+		launcherLayer := result.Layers[1]
+		Expect(launcherLayer.Name).To(Equal("launcher"))
+		Expect(launcherLayer.Path).To(Equal(filepath.Join(layersDir, "launcher")))
+		Expect(launcherLayer.Launch).To(BeTrue())
+		Expect(launcherLayer.Metadata).To(Equal(map[string]interface{}{
+			nginx.LauncherBinKey: "some-bin-sha",
+		}))
+		launcher, err := os.ReadFile(filepath.Join(launcherLayer.Path, "bin", "launcher"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(launcher)).To(Equal("launcher-contents"))
+
 		Expect(result.Launch.BOM).To(Equal([]packit.BOMEntry{
 			{
 				Name: "nginx",
@@ -167,10 +193,11 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		Expect(result.Launch.Processes).To(Equal([]packit.Process{
 			{
 				Type:    "web",
-				Command: "nginx",
+				Command: filepath.Join(layersDir, "launcher", "bin", "launcher"),
 				Args: []string{
-					"-p", workspaceDir,
-					"-c", filepath.Join(workspaceDir, nginx.ConfFile),
+					"nginx",
+					"-p", nginx.RuntimeDir,
+					"-c", filepath.Join(nginx.RuntimeDir, nginx.ConfFile),
 					"-g", "pid /tmp/nginx.pid;",
 				},
 				Direct:  true,
@@ -259,7 +286,7 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		Expect(dependencyService.DeliverCall.Receives.CnbPath).To(Equal(cnbPath))
 		Expect(dependencyService.DeliverCall.Receives.LayerPath).To(Equal(filepath.Join(layersDir, "nginx")))
 		Expect(dependencyService.DeliverCall.Receives.PlatformPath).To(Equal("platform"))
-		Expect(calculator.SumCall.CallCount).To(Equal(1))
+		Expect(calculator.SumCall.CallCount).To(Equal(2))
 
 		Expect(sbomGenerator.GenerateFromDependencyCall.Receives.Dependency).To(Equal(postal.Dependency{
 			ID:             "nginx",
@@ -285,6 +312,7 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 				configGenerator,
 				calculator,
 				sbomGenerator,
+				precompressor,
 				scribe.NewEmitter(buffer),
 				chronos.DefaultClock,
 			)
@@ -303,9 +331,11 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 						"--watch", workspaceDir,
 						"--shell", "none",
 						"--",
+						filepath.Join(layersDir, "launcher", "bin", "launcher"),
+						"--configure", filepath.Join(layersDir, "nginx", "exec.d", "0-configure"),
 						"nginx",
-						"-p", workspaceDir,
-						"-c", filepath.Join(workspaceDir, nginx.ConfFile),
+						"-p", nginx.RuntimeDir,
+						"-c", filepath.Join(nginx.RuntimeDir, nginx.ConfFile),
 						"-g", "pid /tmp/nginx.pid;",
 					},
 					Direct:  true,
@@ -313,10 +343,11 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 				},
 				{
 					Type:    "no-reload",
-					Command: "nginx",
+					Command: filepath.Join(layersDir, "launcher", "bin", "launcher"),
 					Args: []string{
-						"-p", workspaceDir,
-						"-c", filepath.Join(workspaceDir, nginx.ConfFile),
+						"nginx",
+						"-p", nginx.RuntimeDir,
+						"-c", filepath.Join(nginx.RuntimeDir, nginx.ConfFile),
 						"-g", "pid /tmp/nginx.pid;",
 					},
 					Direct: true,
@@ -348,7 +379,7 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			result, err := build(buildContext)
 			Expect(err).NotTo(HaveOccurred())
 
-			Expect(len(result.Layers)).To(Equal(1))
+			Expect(len(result.Layers)).To(Equal(2))
 			layer := result.Layers[0]
 
 			Expect(layer.Name).To(Equal("nginx"))
@@ -363,6 +394,7 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			Expect(layer.Metadata).To(Equal(map[string]interface{}{
 				nginx.DepKey:          "sha256:some-sha",
 				nginx.ConfigureBinKey: "some-bin-sha",
+				nginx.ModulesKey:      []string{},
 			}))
 
 			Expect(result.Launch.BOM).To(Equal([]packit.BOMEntry{
@@ -382,10 +414,11 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			Expect(result.Launch.Processes).To(Equal([]packit.Process{
 				{
 					Type:    "web",
-					Command: "nginx",
+					Command: filepath.Join(layersDir, "launcher", "bin", "launcher"),
 					Args: []string{
-						"-p", workspaceDir,
-						"-c", filepath.Join(workspaceDir, nginx.ConfFile),
+						"nginx",
+						"-p", nginx.RuntimeDir,
+						"-c", filepath.Join(nginx.RuntimeDir, nginx.ConfFile),
 						"-g", "pid /tmp/nginx.pid;",
 					},
 					Direct:  true,
@@ -414,7 +447,7 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			Expect(dependencyService.DeliverCall.Receives.CnbPath).To(Equal(cnbPath))
 			Expect(dependencyService.DeliverCall.Receives.LayerPath).To(Equal(filepath.Join(layersDir, "nginx")))
 			Expect(dependencyService.DeliverCall.Receives.PlatformPath).To(Equal("platform"))
-			Expect(calculator.SumCall.CallCount).To(Equal(1))
+			Expect(calculator.SumCall.CallCount).To(Equal(2))
 
 			Expect(buffer.String()).To(ContainSubstring("WARNING: Setting the server version through buildpack.yml will be deprecated soon in Nginx Server Buildpack v2.0.0"))
 			Expect(buffer.String()).To(ContainSubstring("Please specify the version through the $BP_NGINX_VERSION environment variable instead. See docs for more information."))
@@ -440,7 +473,7 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			result, err := build(buildContext)
 			Expect(err).NotTo(HaveOccurred())
 
-			Expect(len(result.Layers)).To(Equal(1))
+			Expect(len(result.Layers)).To(Equal(2))
 			layer := result.Layers[0]
 
 			Expect(layer.Name).To(Equal("nginx"))
@@ -470,10 +503,11 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			Expect(result.Launch.Processes).To(Equal([]packit.Process{
 				{
 					Type:    "web",
-					Command: "nginx",
+					Command: filepath.Join(layersDir, "launcher", "bin", "launcher"),
 					Args: []string{
-						"-p", workspaceDir,
-						"-c", filepath.Join(workspaceDir, nginx.ConfFile),
+						"nginx",
+						"-p", nginx.RuntimeDir,
+						"-c", filepath.Join(nginx.RuntimeDir, nginx.ConfFile),
 						"-g", "pid /tmp/nginx.pid;",
 					},
 					Direct:  true,
@@ -485,6 +519,201 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		})
 	})
 
+	context("when BP_NGINX_MODULES is set", func() {
+		var delivered []string
+
+		it.Before(func() {
+			dependencyService.ResolveCall.Stub = func(path, name, version, stack string) (postal.Dependency, error) {
+				if name == "nginx" {
+					return postal.Dependency{ID: "nginx", Checksum: "sha256:some-sha", Version: "1.19.8"}, nil
+				}
+
+				return postal.Dependency{ID: name, Checksum: "sha256:" + name + "-sha", Version: version}, nil
+			}
+
+			delivered = nil
+			dependencyService.DeliverCall.Stub = func(dependency postal.Dependency, cnbPath, layerPath, platformPath string) error {
+				delivered = append(delivered, fmt.Sprintf("%s -> %s", dependency.ID, layerPath))
+
+				modules := map[string]string{
+					"nginx-module-headers-more": "ngx_http_headers_more_filter_module.so",
+					"nginx-module-brotli":       "ngx_http_brotli_filter_module.so",
+				}
+				if module, ok := modules[dependency.ID]; ok {
+					return os.WriteFile(filepath.Join(layerPath, module), nil, 0600)
+				}
+
+				return nil
+			}
+
+			build = nginx.Build(
+				nginx.Configuration{
+					NGINXConfLocation: "./nginx.conf",
+					NGINXModules:      nginx.StringList{"headers-more", "brotli"},
+				},
+				dependencyService,
+				configGenerator,
+				calculator,
+				sbomGenerator,
+				precompressor,
+				scribe.NewEmitter(buffer),
+				chronos.DefaultClock,
+			)
+		})
+
+		it("installs the modules built for the nginx version into a layer", func() {
+			result, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(delivered).To(Equal([]string{
+				fmt.Sprintf("nginx-module-headers-more -> %s", filepath.Join(layersDir, "modules")),
+				fmt.Sprintf("nginx-module-brotli -> %s", filepath.Join(layersDir, "modules")),
+				fmt.Sprintf("nginx -> %s", filepath.Join(layersDir, "nginx")),
+			}))
+
+			Expect(result.Layers).To(HaveLen(3))
+			layer := result.Layers[1]
+
+			Expect(layer.Name).To(Equal("modules"))
+			Expect(layer.Path).To(Equal(filepath.Join(layersDir, "modules")))
+			Expect(layer.Launch).To(BeTrue())
+			Expect(layer.Build).To(BeFalse())
+			Expect(layer.LaunchEnv).To(Equal(packit.Environment{
+				"EXECD_MODULES_DIR.default": filepath.Join(layersDir, "modules"),
+			}))
+			Expect(layer.Metadata).To(Equal(map[string]interface{}{
+				"checksums": map[string]interface{}{
+					"headers-more": "sha256:nginx-module-headers-more-sha",
+					"brotli":       "sha256:nginx-module-brotli-sha",
+				},
+				nginx.ModulesKey: []string{"ngx_http_brotli_filter_module", "ngx_http_headers_more_filter_module"},
+			}))
+
+			Expect(dependencyService.GenerateBillOfMaterialsCall.Receives.Dependencies).To(Equal([]postal.Dependency{
+				{ID: "nginx", Checksum: "sha256:some-sha", Version: "1.19.8"},
+				{ID: "nginx-module-headers-more", Checksum: "sha256:nginx-module-headers-more-sha", Version: "1.19.8"},
+				{ID: "nginx-module-brotli", Checksum: "sha256:nginx-module-brotli-sha", Version: "1.19.8"},
+			}))
+
+			Expect(buffer.String()).To(ContainSubstring("Installing nginx modules"))
+			Expect(buffer.String()).To(ContainSubstring("Installing headers-more 1.19.8"))
+			Expect(buffer.String()).To(ContainSubstring("Available modules: ngx_http_brotli_filter_module, ngx_http_headers_more_filter_module"))
+		})
+
+		context("when the modules layer can be reused", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(layersDir, "modules.toml"), []byte(`[metadata]
+				modules = ["ngx_http_headers_more_filter_module"]
+
+				[metadata.checksums]
+				headers-more = "sha256:nginx-module-headers-more-sha"
+				brotli = "sha256:nginx-module-brotli-sha"
+				`), 0600)).To(Succeed())
+			})
+
+			it("does not install the modules again", func() {
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(delivered).To(Equal([]string{
+					fmt.Sprintf("nginx -> %s", filepath.Join(layersDir, "nginx")),
+				}))
+
+				Expect(result.Layers).To(HaveLen(3))
+				Expect(result.Layers[1].Name).To(Equal("modules"))
+				Expect(result.Layers[1].Launch).To(BeTrue())
+				Expect(buffer.String()).To(ContainSubstring(fmt.Sprintf("Reusing cached layer %s", filepath.Join(layersDir, "modules"))))
+			})
+		})
+	})
+
+	context("when the launcher layer can be reused", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(layersDir, "launcher.toml"), []byte(`[metadata]
+			launcher-bin-sha = "some-bin-sha"
+			`), 0600)).To(Succeed())
+		})
+
+		it("does not install the launcher again", func() {
+			result, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(result.Layers).To(HaveLen(2))
+			Expect(result.Layers[1].Name).To(Equal("launcher"))
+			Expect(result.Layers[1].Launch).To(BeTrue())
+			Expect(buffer.String()).To(ContainSubstring(fmt.Sprintf("Reusing cached layer %s", filepath.Join(layersDir, "launcher"))))
+			Expect(buffer.String()).NotTo(ContainSubstring("Installing the launcher binary"))
+		})
+	})
+
+	context("when BP_NGINX_METRICS_EXPORTER is set", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(cnbPath, "bin", "exporter"), []byte("exporter-contents"), 0700)).To(Succeed())
+
+			build = nginx.Build(
+				nginx.Configuration{
+					NGINXConfLocation:    "./nginx.conf",
+					NGINXStubStatusPort:  "8083",
+					NGINXMetricsExporter: true,
+				},
+				dependencyService,
+				configGenerator,
+				calculator,
+				sbomGenerator,
+				precompressor,
+				scribe.NewEmitter(buffer),
+				chronos.DefaultClock,
+			)
+		})
+
+		it("installs the exporter into a layer and adds a metrics process", func() {
+			result, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(result.Layers).To(HaveLen(3))
+			layer := result.Layers[2]
+
+			Expect(layer.Name).To(Equal("metrics-exporter"))
+			Expect(layer.Path).To(Equal(filepath.Join(layersDir, "metrics-exporter")))
+			Expect(layer.Launch).To(BeTrue())
+			Expect(layer.Metadata).To(Equal(map[string]interface{}{
+				nginx.ExporterBinKey: "some-bin-sha",
+			}))
+			contents, err := os.ReadFile(filepath.Join(layer.Path, "bin", "exporter"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("exporter-contents"))
+
+			Expect(calculator.SumCall.Receives.Paths).To(Equal([]string{filepath.Join(cnbPath, "bin", "configure")}))
+
+			Expect(result.Launch.Processes).To(ContainElement(packit.Process{
+				Type:    "metrics",
+				Command: filepath.Join(layersDir, "metrics-exporter", "bin", "exporter"),
+				Args:    []string{"--stub-status-url", "http://127.0.0.1:8083/stub_status"},
+				Direct:  true,
+			}))
+			Expect(buffer.String()).To(ContainSubstring("Installing the exporter binary"))
+		})
+
+		context("when the exporter layer can be reused", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(layersDir, "metrics-exporter.toml"), []byte(`[metadata]
+				exporter-bin-sha = "some-bin-sha"
+				`), 0600)).To(Succeed())
+			})
+
+			it("does not install the exporter again", func() {
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(result.Layers).To(HaveLen(3))
+				Expect(result.Layers[2].Name).To(Equal("metrics-exporter"))
+				Expect(result.Layers[2].Launch).To(BeTrue())
+				Expect(buffer.String()).To(ContainSubstring(fmt.Sprintf("Reusing cached layer %s", filepath.Join(layersDir, "metrics-exporter"))))
+				Expect(buffer.String()).NotTo(ContainSubstring("Installing the exporter binary"))
+			})
+		})
+	})
+
 	context("when BP_NGINX_CONF_LOCATION is set to a relative path", func() {
 		it.Before(func() {
 			Expect(os.Mkdir(filepath.Join(workspaceDir, "some-relative-path"), os.ModePerm)).To(Succeed())
@@ -496,6 +725,7 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 				configGenerator,
 				calculator,
 				sbomGenerator,
+				precompressor,
 				scribe.NewEmitter(buffer),
 				chronos.DefaultClock,
 			)
@@ -505,12 +735,14 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			result, err := build(buildContext)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(result.Launch.Processes[0].Args).To(Equal([]string{
-				"-p", workspaceDir,
-				"-c", filepath.Join(workspaceDir, "some-relative-path", "nginx.conf"),
+				"nginx",
+				"-p", nginx.RuntimeDir,
+				"-c", filepath.Join(nginx.RuntimeDir, "some-relative-path", "nginx.conf"),
 				"-g", "pid /tmp/nginx.pid;",
 			}))
 			Expect(result.Layers[0].LaunchEnv).To(Equal(packit.Environment{
-				"EXECD_CONF.default": filepath.Join(workspaceDir, "some-relative-path/nginx.conf"),
+				"EXECD_CONF.default":        filepath.Join(workspaceDir, "some-relative-path/nginx.conf"),
+				"EXECD_RUNTIME_DIR.default": nginx.RuntimeDir,
 			}))
 		})
 	})
@@ -526,6 +758,7 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 				configGenerator,
 				calculator,
 				sbomGenerator,
+				precompressor,
 				scribe.NewEmitter(buffer),
 				chronos.DefaultClock,
 			)
@@ -535,12 +768,14 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			result, err := build(buildContext)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(result.Launch.Processes[0].Args).To(Equal([]string{
-				"-p", workspaceDir,
-				"-c", filepath.Join(workspaceDir, "some-absolute-path", "nginx.conf"),
+				"nginx",
+				"-p", nginx.RuntimeDir,
+				"-c", filepath.Join(nginx.RuntimeDir, "some-absolute-path", "nginx.conf"),
 				"-g", "pid /tmp/nginx.pid;",
 			}))
 			Expect(result.Layers[0].LaunchEnv).To(Equal(packit.Environment{
-				"EXECD_CONF.default": filepath.Join(workspaceDir, "some-absolute-path", "nginx.conf"),
+				"EXECD_CONF.default":        filepath.Join(workspaceDir, "some-absolute-path", "nginx.conf"),
+				"EXECD_RUNTIME_DIR.default": nginx.RuntimeDir,
 			}))
 		})
 	})
@@ -557,6 +792,7 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 				configGenerator,
 				calculator,
 				sbomGenerator,
+				precompressor,
 				scribe.NewEmitter(buffer),
 				chronos.DefaultClock,
 			)
@@ -572,12 +808,46 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			}))
 
 			Expect(result.Layers[0].LaunchEnv).To(Equal(packit.Environment{
-				"APP_ROOT.default":   workspaceDir, // generated nginx conf relies on this env var
-				"EXECD_CONF.default": filepath.Join(workspaceDir, "nginx.conf"),
-				"PORT.default":       "8080",
+				"APP_ROOT.default":          workspaceDir, // generated nginx conf relies on this env var
+				"EXECD_CONF.default":        filepath.Join(workspaceDir, "nginx.conf"),
+				"EXECD_RUNTIME_DIR.default": nginx.RuntimeDir,
+				"PORT.default":              "8080",
 			}))
 		})
 
+		context("and the web server root contains a _redirects file", func() {
+			it.Before(func() {
+				Expect(os.Mkdir(filepath.Join(workspaceDir, "custom"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workspaceDir, "custom", "_redirects"), []byte("/old /new 302"), 0600)).To(Succeed())
+			})
+
+			it("passes the parsed rules into template generator", func() {
+				_, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(configGenerator.GenerateCall.Receives.Config.Redirects).To(Equal([]nginx.RedirectRule{
+					{Regex: `^/old/?$`, Replacement: "/new", Flag: "redirect"},
+				}))
+			})
+		})
+
+		context("and the web server root contains a _headers file", func() {
+			it.Before(func() {
+				Expect(os.Mkdir(filepath.Join(workspaceDir, "custom"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workspaceDir, "custom", "_headers"), []byte("/*\n  X-Frame-Options: DENY\n"), 0600)).To(Succeed())
+			})
+
+			it("passes the parsed rules into template generator", func() {
+				_, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(configGenerator.GenerateCall.Receives.Config.Headers).To(Equal([]nginx.HeaderRule{
+					{
+						Regex:   `^/.*(\?.*)?$`,
+						Headers: []nginx.ResponseHeader{{Name: "X-Frame-Options", Value: "DENY"}},
+					},
+				}))
+			})
+		})
+
 		context("and nginx layer is being reused", func() {
 			it.Before(func() {
 				err := os.WriteFile(filepath.Join(layersDir, "nginx.toml"), []byte(`[metadata]
@@ -603,23 +873,182 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		})
 	})
 
+	context("when BP_WEB_SERVER_RUNTIME_ENV_PREFIX is set", func() {
+		it.Before(func() {
+			build = nginx.Build(
+				nginx.Configuration{
+					NGINXConfLocation:         "./nginx.conf",
+					WebServer:                 "nginx",
+					WebServerRoot:             "custom",
+					WebServerRuntimeEnvPrefix: "PUBLIC_",
+					WebServerRuntimeEnvFile:   "config/env.js",
+				},
+				dependencyService,
+				configGenerator,
+				calculator,
+				sbomGenerator,
+				precompressor,
+				scribe.NewEmitter(buffer),
+				chronos.DefaultClock,
+			)
+		})
+
+		it("tells the configure binary where to write the environment variables at launch", func() {
+			result, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Layers[0].LaunchEnv).To(Equal(packit.Environment{
+				"APP_ROOT.default":                 workspaceDir,
+				"EXECD_CONF.default":               filepath.Join(workspaceDir, "nginx.conf"),
+				"EXECD_RUNTIME_DIR.default":        nginx.RuntimeDir,
+				"EXECD_RUNTIME_ENV_FILE.default":   filepath.Join(nginx.RuntimeDir, "runtime-env", "config", "env.js"),
+				"EXECD_RUNTIME_ENV_PREFIX.default": "PUBLIC_",
+				"PORT.default":                     "8080",
+			}))
+		})
+
+		context("and nginx layer is being reused", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(layersDir, "nginx.toml"), []byte(`[metadata]
+			dependency-sha = "some-sha"
+			configure-bin-sha = "some-bin-sha"
+			`), 0600)).To(Succeed())
+
+				Expect(os.MkdirAll(filepath.Join(layersDir, "nginx", "env.launch"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(layersDir, "nginx", "env.launch", "EXECD_RUNTIME_ENV_PREFIX.default"), []byte("OLD_"), 0600)).To(Succeed())
+			})
+
+			it("updates the environment of the reused layer", func() {
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Layers[0].LaunchEnv).To(HaveKeyWithValue("EXECD_RUNTIME_ENV_PREFIX.default", "PUBLIC_"))
+				Expect(result.Layers[0].LaunchEnv).To(HaveKeyWithValue("EXECD_RUNTIME_ENV_FILE.default", filepath.Join(nginx.RuntimeDir, "runtime-env", "config", "env.js")))
+			})
+		})
+	})
+
 	context("when the nginx.conf and included files need their permissions set", func() {
+		var outsideConf string
+
 		it.Before(func() {
-			Expect(os.WriteFile(filepath.Join(workspaceDir, "nginx.conf"), []byte("include custom.conf;"), 0600)).To(Succeed())
-			Expect(os.WriteFile(filepath.Join(workspaceDir, "custom.conf"), []byte("worker_processes 2;"), 0600)).To(Succeed())
+			outsideConf = filepath.Join(t.TempDir(), "outside.conf")
+			Expect(os.WriteFile(outsideConf, []byte("worker_processes 2;"), 0600)).To(Succeed())
+
+			Expect(os.WriteFile(filepath.Join(workspaceDir, "nginx.conf"), []byte(fmt.Sprintf("include custom.conf;\ninclude %s;", outsideConf)), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workspaceDir, "custom.conf"), []byte("http { include conf.d/*; }"), 0600)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(workspaceDir, "conf.d"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workspaceDir, "conf.d", "mime.types"), []byte("types {}"), 0600)).To(Succeed())
 		})
 
-		it("modifies their permissions to be group read-writable", func() {
+		it("modifies their permissions to be group readable", func() {
 			_, err := build(buildContext)
 			Expect(err).NotTo(HaveOccurred())
 
 			info, err := os.Stat(filepath.Join(workspaceDir, "nginx.conf"))
 			Expect(err).NotTo(HaveOccurred())
-			Expect(info.Mode().String()).To(Equal("-rw-rw----"))
+			Expect(info.Mode().String()).To(Equal("-rw-r-----"))
 
 			info, err = os.Stat(filepath.Join(workspaceDir, "custom.conf"))
 			Expect(err).NotTo(HaveOccurred())
-			Expect(info.Mode().String()).To(Equal("-rw-rw----"))
+			Expect(info.Mode().String()).To(Equal("-rw-r-----"))
+
+			info, err = os.Stat(filepath.Join(workspaceDir, "conf.d", "mime.types"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().String()).To(Equal("-rw-r-----"))
+
+			info, err = os.Stat(outsideConf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().String()).To(Equal("-rw-------"))
+		})
+	})
+
+	context("when the nginx.conf can't be parsed", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workspaceDir, "nginx.conf"), []byte("include custom.conf;\nhttp {\n  worker_processes 2;\n"), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workspaceDir, "custom.conf"), []byte("worker_processes 2;"), 0600)).To(Succeed())
+		})
+
+		it("reports a warning and sets the permissions of the included files", func() {
+			_, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).To(ContainSubstring(`nginx.conf:4: warning: unexpected end of file, expecting "}"; the configuration can't be checked`))
+
+			info, err := os.Stat(filepath.Join(workspaceDir, "custom.conf"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().String()).To(Equal("-rw-r-----"))
+		})
+	})
+
+	context("when the nginx.conf loads a module relative to the prefix", func() {
+		it.Before(func() {
+			Expect(os.MkdirAll(filepath.Join(workspaceDir, "conf"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workspaceDir, "conf", "nginx.conf"), []byte("load_module modules/ngx_app_module.so;"), 0600)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(workspaceDir, "modules"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workspaceDir, "modules", "ngx_app_module.so"), nil, 0600)).To(Succeed())
+
+			build = nginx.Build(
+				nginx.Configuration{NGINXConfLocation: "./conf/nginx.conf"},
+				dependencyService,
+				configGenerator,
+				calculator,
+				sbomGenerator,
+				precompressor,
+				scribe.NewEmitter(buffer),
+				chronos.DefaultClock,
+			)
+		})
+
+		it("resolves it against the app dir, which nginx runs with as its prefix", func() {
+			_, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buffer.String()).NotTo(ContainSubstring("doesn't exist"))
+		})
+	})
+
+	context("when the nginx.conf has warnings", func() {
+		var buildWithLintWarnings func(lintWarnings string) packit.BuildFunc
+
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workspaceDir, "nginx.conf"), []byte("user nginx;\nworker_processes 2;"), 0600)).To(Succeed())
+
+			buildWithLintWarnings = func(lintWarnings string) packit.BuildFunc {
+				return nginx.Build(
+					nginx.Configuration{NGINXConfLocation: "./nginx.conf", NGINXLintWarnings: lintWarnings},
+					dependencyService,
+					configGenerator,
+					calculator,
+					sbomGenerator,
+					precompressor,
+					scribe.NewEmitter(buffer),
+					chronos.DefaultClock,
+				)
+			}
+		})
+
+		it("reports them with their location", func() {
+			_, err := buildWithLintWarnings("")(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).To(ContainSubstring("Checking nginx configuration"))
+			Expect(buffer.String()).To(ContainSubstring("nginx.conf:1: warning: 'user' has no effect, as nginx doesn't run as root; remove it"))
+		})
+
+		context("when BP_NGINX_LINT_WARNINGS is off", func() {
+			it("doesn't report them", func() {
+				_, err := buildWithLintWarnings("off")(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buffer.String()).NotTo(ContainSubstring("Checking nginx configuration"))
+			})
+		})
+
+		context("when BP_NGINX_LINT_WARNINGS is error", func() {
+			it("fails the build", func() {
+				_, err := buildWithLintWarnings("error")(buildContext)
+				Expect(err).To(MatchError("nginx configuration check failed with 1 problem(s), see the build log for details"))
+
+				Expect(buffer.String()).To(ContainSubstring("nginx.conf:1: warning: 'user' has no effect"))
+			})
 		})
 	})
 
@@ -653,6 +1082,7 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 				configGenerator,
 				calculator,
 				sbomGenerator,
+				precompressor,
 				scribe.NewEmitter(buffer),
 				chronos.DefaultClock,
 			)
@@ -664,6 +1094,96 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		})
 	})
 
+	context("when custom error pages are configured", func() {
+		it.Before(func() {
+			Expect(os.MkdirAll(filepath.Join(workspaceDir, "custom", "errors"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workspaceDir, "custom", "404.html"), []byte(""), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workspaceDir, "custom", "errors", "50x.html"), []byte(""), 0644)).To(Succeed())
+
+			build = nginx.Build(
+				nginx.Configuration{
+					NGINXConfLocation:     "./nginx.conf",
+					WebServer:             "nginx",
+					WebServerRoot:         "custom",
+					WebServerErrorPage404: "404.html",
+					WebServerErrorPage5xx: "/errors/50x.html",
+				},
+				dependencyService,
+				configGenerator,
+				calculator,
+				sbomGenerator,
+				precompressor,
+				scribe.NewEmitter(buffer),
+				chronos.DefaultClock,
+			)
+		})
+
+		it("checks that they exist within the web server root and generates the nginx.conf", func() {
+			_, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(configGenerator.GenerateCall.CallCount).To(Equal(1))
+		})
+	})
+
+	context("when BP_WEB_SERVER_PRECOMPRESS is enabled", func() {
+		it.Before(func() {
+			Expect(os.Mkdir(filepath.Join(workspaceDir, "public"), os.ModePerm)).To(Succeed())
+
+			precompressor.PrecompressCall.Returns.PrecompressResult = nginx.PrecompressResult{Compressed: 2, Reused: 3}
+
+			build = nginx.Build(
+				nginx.Configuration{
+					NGINXConfLocation:          "./nginx.conf",
+					WebServerRoot:              "./public",
+					WebServerPrecompress:       true,
+					WebServerPrecompressBrotli: true,
+				},
+				dependencyService,
+				configGenerator,
+				calculator,
+				sbomGenerator,
+				precompressor,
+				scribe.NewEmitter(buffer),
+				chronos.DefaultClock,
+			)
+		})
+
+		it("precompresses the assets in the web server root into a cached layer", func() {
+			result, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(precompressor.PrecompressCall.Receives.Root).To(Equal(filepath.Join(workspaceDir, "public")))
+			Expect(precompressor.PrecompressCall.Receives.CachePath).To(Equal(filepath.Join(layersDir, nginx.PrecompressedAssets)))
+			Expect(precompressor.PrecompressCall.Receives.Brotli).To(BeTrue())
+
+			Expect(result.Layers).To(HaveLen(3))
+			Expect(result.Layers[1].Name).To(Equal(nginx.PrecompressedAssets))
+			Expect(result.Layers[1].Cache).To(BeTrue())
+			Expect(result.Layers[1].Launch).To(BeFalse())
+			Expect(result.Layers[1].Build).To(BeFalse())
+
+			Expect(buffer.String()).To(ContainSubstring("Compressed 2 file(s), reused 3 cached file(s)"))
+		})
+
+		context("and nginx layer is being reused", func() {
+			it.Before(func() {
+				err := os.WriteFile(filepath.Join(layersDir, "nginx.toml"), []byte(`[metadata]
+			dependency-sha = "some-sha"
+			configure-bin-sha = "some-bin-sha"
+			`), 0600)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			it("still precompresses the assets", func() {
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(precompressor.PrecompressCall.CallCount).To(Equal(1))
+				Expect(result.Layers).To(HaveLen(3))
+			})
+		})
+	})
+
 	context("failure cases", func() {
 		context("when the dependency cannot be resolved", func() {
 			it.Before(func() {
@@ -684,6 +1204,7 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 					configGenerator,
 					calculator,
 					sbomGenerator,
+					precompressor,
 					scribe.NewEmitter(buffer),
 					chronos.DefaultClock,
 				)
@@ -772,6 +1293,98 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			})
 		})
 
+		context("when the _redirects file contains an unsupported rule", func() {
+			it.Before(func() {
+				Expect(os.Mkdir(filepath.Join(workspaceDir, "public"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workspaceDir, "public", "_redirects"), []byte("/old /new 302\n/gone /404.html 404\n"), 0600)).To(Succeed())
+
+				build = nginx.Build(
+					nginx.Configuration{
+						NGINXConfLocation: "./nginx.conf",
+						WebServer:         "nginx",
+						WebServerRoot:     "./public",
+					},
+					dependencyService,
+					configGenerator,
+					calculator,
+					sbomGenerator,
+					precompressor,
+					scribe.NewEmitter(buffer),
+					chronos.DefaultClock,
+				)
+			})
+
+			it("returns an error with the line number", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError("public/_redirects:2: status code '404' is not supported, must be one of 200, 301 or 302"))
+			})
+		})
+
+		context("when the _headers file contains an unsupported rule", func() {
+			it.Before(func() {
+				Expect(os.Mkdir(filepath.Join(workspaceDir, "public"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workspaceDir, "public", "_headers"), []byte("/*\n  ! X-Frame-Options\n"), 0600)).To(Succeed())
+
+				build = nginx.Build(
+					nginx.Configuration{
+						NGINXConfLocation: "./nginx.conf",
+						WebServer:         "nginx",
+						WebServerRoot:     "./public",
+					},
+					dependencyService,
+					configGenerator,
+					calculator,
+					sbomGenerator,
+					precompressor,
+					scribe.NewEmitter(buffer),
+					chronos.DefaultClock,
+				)
+			})
+
+			it("returns an error with the line number", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError("public/_headers:2: removing headers with '! X-Frame-Options' is not supported"))
+			})
+		})
+
+		context("when precompression is enabled", func() {
+			it.Before(func() {
+				build = nginx.Build(
+					nginx.Configuration{
+						NGINXConfLocation:    "./nginx.conf",
+						WebServerRoot:        "./public",
+						WebServerPrecompress: true,
+					},
+					dependencyService,
+					configGenerator,
+					calculator,
+					sbomGenerator,
+					precompressor,
+					scribe.NewEmitter(buffer),
+					chronos.DefaultClock,
+				)
+			})
+
+			context("and the web server root does not exist", func() {
+				it("returns an error", func() {
+					_, err := build(buildContext)
+					Expect(err).To(MatchError("failed to precompress assets: web server root ./public (BP_WEB_SERVER_ROOT) doesn't exist within app dir"))
+				})
+			})
+
+			context("and the assets cannot be precompressed", func() {
+				it.Before(func() {
+					Expect(os.Mkdir(filepath.Join(workspaceDir, "public"), os.ModePerm)).To(Succeed())
+					precompressor.PrecompressCall.Returns.Error = errors.New("failed to precompress")
+				})
+
+				it("returns an error", func() {
+					_, err := build(buildContext)
+					Expect(err).To(MatchError("failed to precompress"))
+				})
+			})
+		})
+
 		context("when BP_WEB_SERVER_INCLUDE_FILE_PATH is set", func() {
 			it.Before(func() {
 				build = nginx.Build(
@@ -784,6 +1397,7 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 					configGenerator,
 					calculator,
 					sbomGenerator,
+					precompressor,
 					scribe.NewEmitter(buffer),
 					chronos.DefaultClock,
 				)
@@ -793,5 +1407,191 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 				Expect(err).To(MatchError("file ./included-file.conf (BP_WEB_SERVER_INCLUDE_FILE_PATH) doesn't exist within app dir"))
 			})
 		})
+
+		context("when a module of BP_NGINX_MODULES is not available", func() {
+			it.Before(func() {
+				dependencyService.ResolveCall.Stub = func(path, name, version, stack string) (postal.Dependency, error) {
+					if name == "nginx" {
+						return postal.Dependency{ID: "nginx", Version: "1.19.8"}, nil
+					}
+
+					return postal.Dependency{}, errors.New("no compatible versions")
+				}
+
+				build = nginx.Build(
+					nginx.Configuration{NGINXConfLocation: "./nginx.conf", NGINXModules: nginx.StringList{"geoip2"}},
+					dependencyService,
+					configGenerator,
+					calculator,
+					sbomGenerator,
+					precompressor,
+					scribe.NewEmitter(buffer),
+					chronos.DefaultClock,
+				)
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError(`module "geoip2" (BP_NGINX_MODULES) is not available for nginx 1.19.8: no compatible versions`))
+			})
+		})
+
+		context("when BP_NGINX_METRICS_EXPORTER is set without BP_NGINX_STUB_STATUS_PORT", func() {
+			it.Before(func() {
+				build = nginx.Build(
+					nginx.Configuration{NGINXConfLocation: "./nginx.conf", NGINXMetricsExporter: true},
+					dependencyService,
+					configGenerator,
+					calculator,
+					sbomGenerator,
+					precompressor,
+					scribe.NewEmitter(buffer),
+					chronos.DefaultClock,
+				)
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError("BP_NGINX_METRICS_EXPORTER requires BP_NGINX_STUB_STATUS_PORT to be set"))
+			})
+		})
+
+		context("when the exporter binary checksum cannot be calculated", func() {
+			it.Before(func() {
+				calculator.SumCall.Stub = func(paths ...string) (string, error) {
+					if filepath.Base(paths[0]) == "exporter" {
+						return "", errors.New("failed to calculate checksum")
+					}
+
+					return "some-bin-sha", nil
+				}
+
+				build = nginx.Build(
+					nginx.Configuration{NGINXConfLocation: "./nginx.conf", NGINXStubStatusPort: "8083", NGINXMetricsExporter: true},
+					dependencyService,
+					configGenerator,
+					calculator,
+					sbomGenerator,
+					precompressor,
+					scribe.NewEmitter(buffer),
+					chronos.DefaultClock,
+				)
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError(ContainSubstring("checksum failed for file")))
+				Expect(err).To(MatchError(ContainSubstring("failed to calculate checksum")))
+			})
+		})
+
+		context("when the nginx.conf has errors", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workspaceDir, "nginx.conf"), []byte("daemon on;\npid /var/run/nginx.pid;"), 0600)).To(Succeed())
+			})
+
+			it("reports them and returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError("nginx configuration check failed with 2 problem(s), see the build log for details"))
+
+				Expect(buffer.String()).To(ContainSubstring("nginx.conf:1: error: 'daemon on' sends nginx to the background"))
+				Expect(buffer.String()).To(ContainSubstring("nginx.conf:2: error: 'pid' conflicts with the pid file set on the command line"))
+			})
+		})
+
+		context("when BP_NGINX_LINT_WARNINGS is invalid", func() {
+			it.Before(func() {
+				build = nginx.Build(
+					nginx.Configuration{NGINXConfLocation: "./nginx.conf", NGINXLintWarnings: "sometimes"},
+					dependencyService,
+					configGenerator,
+					calculator,
+					sbomGenerator,
+					precompressor,
+					scribe.NewEmitter(buffer),
+					chronos.DefaultClock,
+				)
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError(`invalid BP_NGINX_LINT_WARNINGS value "sometimes": expected 'warn', 'error' or 'off'`))
+			})
+		})
+
+		context("when BP_NGINX_CONF_LOCATION is outside of the app dir", func() {
+			var confPath string
+
+			it.Before(func() {
+				confPath = filepath.Join(t.TempDir(), "nginx.conf")
+				Expect(os.WriteFile(confPath, []byte("worker_processes 2;"), 0600)).To(Succeed())
+
+				build = nginx.Build(
+					nginx.Configuration{NGINXConfLocation: confPath},
+					dependencyService,
+					configGenerator,
+					calculator,
+					sbomGenerator,
+					precompressor,
+					scribe.NewEmitter(buffer),
+					chronos.DefaultClock,
+				)
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError(fmt.Sprintf("file %s (BP_NGINX_CONF_LOCATION) must be within app dir", confPath)))
+			})
+		})
+
+		context("when the 404 error page doesn't exist within the web server root", func() {
+			it.Before(func() {
+				build = nginx.Build(
+					nginx.Configuration{
+						WebServer:             "nginx",
+						WebServerRoot:         "custom",
+						WebServerErrorPage404: "404.html",
+					},
+					dependencyService,
+					configGenerator,
+					calculator,
+					sbomGenerator,
+					precompressor,
+					scribe.NewEmitter(buffer),
+					chronos.DefaultClock,
+				)
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError("file 404.html (BP_WEB_SERVER_ERROR_PAGE_404) doesn't exist within web server root"))
+				Expect(configGenerator.GenerateCall.CallCount).To(Equal(0))
+			})
+		})
+
+		context("when the 5xx error page doesn't exist within the web server root", func() {
+			it.Before(func() {
+				build = nginx.Build(
+					nginx.Configuration{
+						WebServer:             "nginx",
+						WebServerRoot:         "custom",
+						WebServerErrorPage5xx: "50x.html",
+					},
+					dependencyService,
+					configGenerator,
+					calculator,
+					sbomGenerator,
+					precompressor,
+					scribe.NewEmitter(buffer),
+					chronos.DefaultClock,
+				)
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError("file 50x.html (BP_WEB_SERVER_ERROR_PAGE_5XX) doesn't exist within web server root"))
+				Expect(configGenerator.GenerateCall.CallCount).To(Equal(0))
+			})
+		})
 	})
 }
@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ExecDEnv returns the environment variables computed at launch that the
+// nginx process and other tooling in the container may rely on: the port,
+// the worker tuning, where the rendered configuration lives and which service
+// bindings it uses. Values that are unknown are left out.
+func ExecDEnv(rendered Rendered, runtimeDir string, resources Resources) (map[string]string, error) {
+	env := map[string]string{}
+
+	if port := os.Getenv("PORT"); port != "" {
+		env["PORT"] = port
+	}
+
+	processes, err := resources.WorkerProcesses()
+	if err != nil {
+		return nil, err
+	}
+	env["NGINX_WORKER_PROCESSES"] = strconv.Itoa(processes)
+
+	connections, err := resources.WorkerConnections()
+	if err != nil {
+		return nil, err
+	}
+	env["NGINX_WORKER_CONNECTIONS"] = strconv.Itoa(connections)
+
+	if rendered.Conf != "" {
+		env["NGINX_CONF"] = rendered.Conf
+		env["NGINX_RUNTIME_DIR"] = runtimeDir
+		env["NGINX_BINDINGS"] = strings.Join(rendered.Bindings, ",")
+	}
+
+	return env, nil
+}
+
+// WriteExecDEnv writes env as the TOML that exec.d binaries write to file
+// descriptor 3, so that the launcher sets the variables for the launch process.
+func WriteExecDEnv(w io.Writer, env map[string]string) error {
+	err := toml.NewEncoder(w).Encode(env)
+	if err != nil {
+		return fmt.Errorf("failed to write exec.d environment: %w", err)
+	}
+
+	return nil
+}
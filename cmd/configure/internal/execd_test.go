@@ -0,0 +1,92 @@
+package internal_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/paketo-buildpacks/nginx/cmd/configure/internal"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testExecDEnv(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		resources internal.Resources
+	)
+
+	it.Before(func() {
+		resources = internal.Resources{CPUs: 2, FileLimit: 2048}
+		t.Setenv("PORT", "8080")
+	})
+
+	context("ExecDEnv", func() {
+		it("returns the values computed at launch", func() {
+			env, err := internal.ExecDEnv(internal.Rendered{
+				Conf:     "/tmp/nginx/nginx.conf",
+				Bindings: []string{"htpasswd", "upstream"},
+			}, "/tmp/nginx", resources)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(env).To(Equal(map[string]string{
+				"PORT":                     "8080",
+				"NGINX_WORKER_PROCESSES":   "2",
+				"NGINX_WORKER_CONNECTIONS": "1024",
+				"NGINX_CONF":               "/tmp/nginx/nginx.conf",
+				"NGINX_RUNTIME_DIR":        "/tmp/nginx",
+				"NGINX_BINDINGS":           "htpasswd,upstream",
+			}))
+		})
+
+		context("when nothing was rendered and there is no port", func() {
+			it.Before(func() {
+				t.Setenv("PORT", "")
+			})
+
+			it("leaves out the unknown values", func() {
+				env, err := internal.ExecDEnv(internal.Rendered{}, "/tmp/nginx", resources)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(env).To(Equal(map[string]string{
+					"NGINX_WORKER_PROCESSES":   "2",
+					"NGINX_WORKER_CONNECTIONS": "1024",
+				}))
+			})
+		})
+
+		context("failure cases", func() {
+			context("when the worker processes override is invalid", func() {
+				it.Before(func() {
+					t.Setenv("BPL_NGINX_WORKER_PROCESSES", "many")
+				})
+
+				it("returns an error", func() {
+					_, err := internal.ExecDEnv(internal.Rendered{}, "/tmp/nginx", resources)
+					Expect(err).To(MatchError(`invalid BPL_NGINX_WORKER_PROCESSES value "many": expected a positive integer`))
+				})
+			})
+		})
+	})
+
+	context("WriteExecDEnv", func() {
+		it("writes the variables as TOML", func() {
+			buffer := bytes.NewBuffer(nil)
+			err := internal.WriteExecDEnv(buffer, map[string]string{
+				"NGINX_CONF": "/tmp/nginx/nginx.conf",
+				"PORT":       "8080",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			var env map[string]string
+			_, err = toml.Decode(buffer.String(), &env)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(env).To(Equal(map[string]string{
+				"NGINX_CONF": "/tmp/nginx/nginx.conf",
+				"PORT":       "8080",
+			}))
+		})
+	})
+}
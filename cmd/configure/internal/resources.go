@@ -0,0 +1,201 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ConnectionMemory is the memory budgeted for each connection when the number
+// of connections is limited by the memory of the container, enough for the
+// default buffers of a proxied request.
+const ConnectionMemory = 256 * 1024
+
+// MaxWorkerConnections caps the number of connections per worker process, as
+// larger numbers only grow the connection tables of nginx.
+const MaxWorkerConnections = 65536
+
+// Resources are the limits of the container nginx runs in. Zero values are
+// unlimited.
+type Resources struct {
+	CPUs        int
+	MemoryLimit int64
+	FileLimit   uint64
+}
+
+// LoadResources reads the CPU quota and the memory limit of the container from
+// the cgroup v2 or v1 hierarchy mounted at cgroupRoot, and the file descriptor
+// limit of the process. The number of CPUs is never larger than the number of
+// CPUs of the host.
+func LoadResources(cgroupRoot string) (Resources, error) {
+	resources := Resources{CPUs: runtime.NumCPU()}
+
+	quota, err := cpuQuota(cgroupRoot)
+	if err != nil {
+		return Resources{}, err
+	}
+
+	if quota > 0 && quota < resources.CPUs {
+		resources.CPUs = quota
+	}
+
+	resources.MemoryLimit, err = memoryLimit(cgroupRoot)
+	if err != nil {
+		return Resources{}, err
+	}
+
+	var rlimit syscall.Rlimit
+	err = syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit)
+	if err != nil {
+		return Resources{}, fmt.Errorf("failed to get file descriptor limit: %w", err)
+	}
+
+	if rlimit.Cur != math.MaxUint64 {
+		resources.FileLimit = rlimit.Cur
+	}
+
+	return resources, nil
+}
+
+// WorkerProcesses returns the number of worker processes nginx runs: one per
+// CPU, unless BPL_NGINX_WORKER_PROCESSES is set.
+func (r Resources) WorkerProcesses() (int, error) {
+	if value, ok := os.LookupEnv("BPL_NGINX_WORKER_PROCESSES"); ok {
+		return parsePositive("BPL_NGINX_WORKER_PROCESSES", value)
+	}
+
+	return max(r.CPUs, 1), nil
+}
+
+// WorkerConnections returns the number of connections each worker process
+// serves, unless BPL_NGINX_WORKER_CONNECTIONS is set. Each proxied connection
+// takes two file descriptors, and the worker processes share the memory of
+// the container, ConnectionMemory for each connection.
+func (r Resources) WorkerConnections() (int, error) {
+	if value, ok := os.LookupEnv("BPL_NGINX_WORKER_CONNECTIONS"); ok {
+		return parsePositive("BPL_NGINX_WORKER_CONNECTIONS", value)
+	}
+
+	workers, err := r.WorkerProcesses()
+	if err != nil {
+		return 0, err
+	}
+
+	connections := uint64(MaxWorkerConnections)
+	if r.FileLimit > 0 {
+		connections = min(connections, r.FileLimit/2)
+	}
+
+	if r.MemoryLimit > 0 {
+		connections = min(connections, uint64(r.MemoryLimit)/ConnectionMemory/uint64(workers))
+	}
+
+	return max(int(connections), 1), nil
+}
+
+func parsePositive(name, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid %s value %q: expected a positive integer", name, value)
+	}
+
+	return n, nil
+}
+
+// cpuQuota returns the number of CPUs the cgroup may use, rounded up, or 0 if
+// it isn't limited.
+func cpuQuota(cgroupRoot string) (int, error) {
+	var quota, period string
+
+	content, err := readCgroupFile(filepath.Join(cgroupRoot, "cpu.max"))
+	if err != nil {
+		return 0, err
+	}
+
+	if content != "" {
+		fields := strings.Fields(content)
+		if len(fields) != 2 {
+			return 0, fmt.Errorf("failed to parse cpu.max: unexpected content %q", content)
+		}
+
+		quota, period = fields[0], fields[1]
+	} else {
+		quota, err = readCgroupFile(filepath.Join(cgroupRoot, "cpu", "cpu.cfs_quota_us"))
+		if err != nil {
+			return 0, err
+		}
+
+		period, err = readCgroupFile(filepath.Join(cgroupRoot, "cpu", "cpu.cfs_period_us"))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if quota == "" || quota == "max" || quota == "-1" {
+		return 0, nil
+	}
+
+	q, err := strconv.ParseInt(quota, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse CPU quota: %w", err)
+	}
+
+	p, err := strconv.ParseInt(period, 10, 64)
+	if err != nil || p <= 0 {
+		return 0, fmt.Errorf("failed to parse CPU period %q", period)
+	}
+
+	return int((q + p - 1) / p), nil
+}
+
+// memoryLimit returns the memory limit of the cgroup in bytes, or 0 if it
+// isn't limited. cgroup v1 reports no limit as a number close to the maximum.
+func memoryLimit(cgroupRoot string) (int64, error) {
+	limit, err := readCgroupFile(filepath.Join(cgroupRoot, "memory.max"))
+	if err != nil {
+		return 0, err
+	}
+
+	if limit == "" {
+		limit, err = readCgroupFile(filepath.Join(cgroupRoot, "memory", "memory.limit_in_bytes"))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if limit == "" || limit == "max" {
+		return 0, nil
+	}
+
+	bytes, err := strconv.ParseUint(limit, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse memory limit: %w", err)
+	}
+
+	if bytes >= 1<<62 {
+		return 0, nil
+	}
+
+	return int64(bytes), nil
+}
+
+// readCgroupFile returns the trimmed content of path, or an empty string if
+// it doesn't exist.
+func readCgroupFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+
+		return "", fmt.Errorf("failed to read cgroup file: %w", err)
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
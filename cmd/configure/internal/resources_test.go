@@ -0,0 +1,154 @@
+package internal_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/paketo-buildpacks/nginx/cmd/configure/internal"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testResources(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		cgroupRoot string
+	)
+
+	it.Before(func() {
+		cgroupRoot = t.TempDir()
+	})
+
+	context("LoadResources", func() {
+		context("with cgroup v2", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(cgroupRoot, "cpu.max"), []byte("150000 100000\n"), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(cgroupRoot, "memory.max"), []byte("536870912\n"), 0600)).To(Succeed())
+			})
+
+			it("reads the CPU quota, rounded up, and the memory limit", func() {
+				resources, err := internal.LoadResources(cgroupRoot)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(resources.CPUs).To(Equal(min(2, runtime.NumCPU())))
+				Expect(resources.MemoryLimit).To(Equal(int64(536870912)))
+			})
+
+			context("when there are no limits", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(cgroupRoot, "cpu.max"), []byte("max 100000\n"), 0600)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(cgroupRoot, "memory.max"), []byte("max\n"), 0600)).To(Succeed())
+				})
+
+				it("uses the CPUs of the host and no memory limit", func() {
+					resources, err := internal.LoadResources(cgroupRoot)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(resources.CPUs).To(Equal(runtime.NumCPU()))
+					Expect(resources.MemoryLimit).To(BeZero())
+				})
+			})
+		})
+
+		context("with cgroup v1", func() {
+			it.Before(func() {
+				Expect(os.MkdirAll(filepath.Join(cgroupRoot, "cpu"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(cgroupRoot, "cpu", "cpu.cfs_quota_us"), []byte("100000\n"), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(cgroupRoot, "cpu", "cpu.cfs_period_us"), []byte("100000\n"), 0600)).To(Succeed())
+
+				Expect(os.MkdirAll(filepath.Join(cgroupRoot, "memory"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(cgroupRoot, "memory", "memory.limit_in_bytes"), []byte("9223372036854771712\n"), 0600)).To(Succeed())
+			})
+
+			it("reads the CPU quota and treats the maximum memory limit as none", func() {
+				resources, err := internal.LoadResources(cgroupRoot)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(resources.CPUs).To(Equal(1))
+				Expect(resources.MemoryLimit).To(BeZero())
+			})
+
+			context("when the CPU quota is unlimited", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(cgroupRoot, "cpu", "cpu.cfs_quota_us"), []byte("-1\n"), 0600)).To(Succeed())
+				})
+
+				it("uses the CPUs of the host", func() {
+					resources, err := internal.LoadResources(cgroupRoot)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(resources.CPUs).To(Equal(runtime.NumCPU()))
+				})
+			})
+		})
+
+		context("when there is no cgroup hierarchy", func() {
+			it("uses the CPUs of the host and no memory limit", func() {
+				resources, err := internal.LoadResources(filepath.Join(cgroupRoot, "missing"))
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(resources.CPUs).To(Equal(runtime.NumCPU()))
+				Expect(resources.MemoryLimit).To(BeZero())
+			})
+		})
+
+		context("failure cases", func() {
+			context("when cpu.max is malformed", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(cgroupRoot, "cpu.max"), []byte("lots\n"), 0600)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := internal.LoadResources(cgroupRoot)
+					Expect(err).To(MatchError(ContainSubstring(`failed to parse cpu.max: unexpected content "lots"`)))
+				})
+			})
+
+			context("when memory.max is malformed", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(cgroupRoot, "memory.max"), []byte("lots\n"), 0600)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := internal.LoadResources(cgroupRoot)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse memory limit")))
+				})
+			})
+		})
+	})
+
+	context("WorkerConnections", func() {
+		it("is limited by the file descriptors", func() {
+			connections, err := internal.Resources{CPUs: 2, FileLimit: 1024}.WorkerConnections()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(connections).To(Equal(512))
+		})
+
+		it("is limited by the memory shared by the worker processes", func() {
+			connections, err := internal.Resources{CPUs: 2, MemoryLimit: 512 * 1024 * 1024, FileLimit: 1048576}.WorkerConnections()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(connections).To(Equal(1024))
+		})
+
+		it("is capped when nothing is limited", func() {
+			connections, err := internal.Resources{CPUs: 2}.WorkerConnections()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(connections).To(Equal(internal.MaxWorkerConnections))
+		})
+
+		context("when an override is invalid", func() {
+			it.Before(func() {
+				t.Setenv("BPL_NGINX_WORKER_PROCESSES", "0")
+			})
+
+			it("returns an error", func() {
+				_, err := internal.Resources{CPUs: 2}.WorkerConnections()
+				Expect(err).To(MatchError(`invalid BPL_NGINX_WORKER_PROCESSES value "0": expected a positive integer`))
+			})
+		})
+	})
+}
@@ -2,30 +2,74 @@ package internal
 
 import (
 	"bytes"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"os"
 	"path/filepath"
-	"regexp"
+	"slices"
+	"strings"
 	"text/template"
+
+	"github.com/paketo-buildpacks/nginx/nginxconf"
+	"github.com/paketo-buildpacks/packit/v2/servicebindings"
 )
 
-func Run(mainConf, localModulePath, globalModulePath string) error {
+// ErrorLogLevels are the levels of the nginx error log, from the most to the
+// least verbose.
+var ErrorLogLevels = []string{"debug", "info", "notice", "warn", "error", "crit", "alert", "emerg"}
+
+// TLS holds the paths of the certificate and key of the 'tls' binding.
+type TLS struct {
+	Certificate string
+	Key         string
+}
+
+// Rendered describes the configuration rendered by Run.
+type Rendered struct {
+	// Conf is the path of the rendered main configuration file
+	Conf string
+	// Bindings are the types of the service bindings used by the templates
+	Bindings []string
+}
+
+// Run renders the templates in mainConf and the files it includes into
+// runtimeDir, leaving the originals untouched. The rendered files take the same
+// paths relative to runtimeDir as the templates have relative to appDir, and
+// every other file of the directories on the way is symlinked from appDir, so
+// that nginx can run with runtimeDir as its prefix even when appDir is
+// read-only. Included files outside of appDir are used as they are. When the
+// configuration can't be parsed, the included .conf files are found by name
+// and absolute includes aren't pointed at the rendered copies.
+//
+// The module template function looks up modules in modulePaths in order,
+// ignoring empty paths, and fails for modules that are in none of them. The
+// modules template function lists the available modules. The binding and
+// bindingValue template functions return the path and the value of an entry
+// of a service binding, the htpasswd template function returns the path of the
+// .htpasswd file of the optional htpasswd binding, and the tls template function
+// returns the certificate and key of the optional tls binding, or nil. The cpus and
+// maxConnections template functions return the number of worker processes and
+// of connections per worker process that fit the resources of the container.
+// The accessLogFormat template function returns the given access log format,
+// unless BPL_WEB_SERVER_ACCESS_LOG_FORMAT overrides it, and the errorLogLevel
+// template function returns NGINX_ERROR_LOG_LEVEL, defaulting to error.
+//
+// Nothing is rendered if mainConf doesn't exist.
+func Run(mainConf, appDir, runtimeDir string, resources Resources, modulePaths ...string) (Rendered, error) {
 	log.SetFlags(0)
 
 	if _, err := os.Stat(mainConf); err != nil {
-		return nil
+		return Rendered{}, nil
 	}
 
-	confs, err := getIncludedConfs(mainConf)
-	if err != nil {
-		return err
+	if _, ok := relativePath(appDir, mainConf); !ok {
+		return Rendered{}, fmt.Errorf("config file %s must be within the app dir %s", mainConf, appDir)
 	}
 
-	confs = append(confs, mainConf)
+	bindings := map[string]bool{}
+
 	templFuncs := template.FuncMap{
 		"env": os.Getenv,
 		"tempDir": func() string {
@@ -34,74 +78,312 @@ func Run(mainConf, localModulePath, globalModulePath string) error {
 		"port": func() string {
 			return os.Getenv("PORT")
 		},
+		"cpus":           resources.WorkerProcesses,
+		"maxConnections": resources.WorkerConnections,
+		"errorLogLevel": func() (string, error) {
+			level := os.Getenv("NGINX_ERROR_LOG_LEVEL")
+			if level == "" {
+				return "error", nil
+			}
+
+			if !slices.Contains(ErrorLogLevels, level) {
+				return "", fmt.Errorf("invalid NGINX_ERROR_LOG_LEVEL value %q: expected one of %s", level, strings.Join(ErrorLogLevels, ", "))
+			}
+
+			return level, nil
+		},
+		"accessLogFormat": func(format string) (string, error) {
+			if override, ok := os.LookupEnv("BPL_WEB_SERVER_ACCESS_LOG_FORMAT"); ok {
+				format = override
+			}
+
+			switch format {
+			case "combined", "json", "off":
+				return format, nil
+			default:
+				return "", fmt.Errorf("invalid BPL_WEB_SERVER_ACCESS_LOG_FORMAT value %q: expected 'combined', 'json' or 'off'", format)
+			}
+		},
 		"module": func(name string) (string, error) {
-			module := filepath.Join(localModulePath, name+".so")
+			module, err := nginxconf.ModulePath(name, modulePaths...)
+			if err != nil {
+				return "", err
+			}
 
-			_, err := os.Stat(module)
+			return fmt.Sprintf("load_module %s;", module), nil
+		},
+		"modules": func() ([]string, error) {
+			return nginxconf.Modules(modulePaths...)
+		},
+		"binding": func(typ, key string) (string, error) {
+			binding, err := resolveBindingEntry(typ, key)
 			if err != nil {
-				if !errors.Is(err, os.ErrNotExist) {
-					return "", fmt.Errorf("failed to execute module function: %s", err)
-				}
+				return "", err
+			}
 
-				module = filepath.Join(globalModulePath, name+".so")
+			if binding.Path == "" {
+				return "", fmt.Errorf("binding of type %q has no files, use bindingValue instead", typ)
 			}
 
-			return fmt.Sprintf("load_module %s;", module), nil
+			bindings[typ] = true
+			return filepath.Join(binding.Path, key), nil
+		},
+		"bindingValue": func(typ, key string) (string, error) {
+			binding, err := resolveBindingEntry(typ, key)
+			if err != nil {
+				return "", err
+			}
+
+			value, err := binding.Entries[key].ReadString()
+			if err != nil {
+				return "", fmt.Errorf("failed to read entry %q of binding of type %q: %w", key, typ, err)
+			}
+
+			bindings[typ] = true
+			return strings.TrimSpace(value), nil
+		},
+		"htpasswd": func() (string, error) {
+			htpasswd, ok, err := resolveOptionalBinding("htpasswd", ".htpasswd")
+			if err != nil {
+				return "", err
+			}
+
+			if !ok {
+				log.Println("No 'htpasswd' binding found, disabling basic authentication")
+				return "", nil
+			}
+
+			log.Printf("Enabling basic authentication with the 'htpasswd' binding %s", htpasswd.Name)
+			bindings["htpasswd"] = true
+			return filepath.Join(htpasswd.Path, ".htpasswd"), nil
+		},
+		"tls": func() (*TLS, error) {
+			tls, ok, err := resolveOptionalBinding("tls", "tls.crt", "tls.key")
+			if err != nil {
+				return nil, err
+			}
+
+			if !ok {
+				log.Println("No 'tls' binding found, disabling TLS")
+				return nil, nil
+			}
+
+			log.Printf("Enabling TLS with the 'tls' binding %s", tls.Name)
+			bindings["tls"] = true
+			return &TLS{
+				Certificate: filepath.Join(tls.Path, "tls.crt"),
+				Key:         filepath.Join(tls.Path, "tls.key"),
+			}, nil
 		},
 	}
 
-	for _, conf := range confs {
-		content, err := os.ReadFile(conf)
+	// Files are rendered before their includes are looked up, so that include
+	// paths may use template functions as well
+	render := func(path string) ([]byte, error) {
+		content, err := os.ReadFile(path)
 		if err != nil {
-			return fmt.Errorf("failed to read config file: %s", err)
+			return nil, err
+		}
+
+		if _, ok := relativePath(appDir, path); !ok {
+			return content, nil
 		}
 
 		tmpl, err := template.New("configure").Option("missingkey=zero").Funcs(templFuncs).Parse(string(content))
 		if err != nil {
-			return fmt.Errorf("failed to parse template: %s", err)
+			return nil, fmt.Errorf("failed to parse template: %s", err)
 		}
 
 		buffer := bytes.NewBuffer(nil)
 		err = tmpl.Execute(buffer, nil)
 		if err != nil {
-			return fmt.Errorf("failed to execute template: %w", err)
+			return nil, fmt.Errorf("failed to execute template: %w", err)
 		}
 
-		if hex.EncodeToString(sha256.New().Sum(content)) != hex.EncodeToString(sha256.New().Sum(buffer.Bytes())) {
-			err = os.WriteFile(conf, buffer.Bytes(), 0600)
-			if err != nil {
-				return fmt.Errorf("failed to overwrite template: %w", err)
-			}
+		return buffer.Bytes(), nil
+	}
+
+	confs, err := nginxconf.Resolve(mainConf, filepath.Dir(mainConf), render)
+	if err != nil {
+		var parseErr *nginxconf.ParseError
+		if !errors.As(err, &parseErr) {
+			return Rendered{}, err
+		}
+
+		// nginx accepts some configurations that the parser doesn't, so their
+		// included files are found by name instead, as the build does
+		log.Printf("Failed to parse %s, finding the included files by name: %s", parseErr.File, parseErr.Err)
+
+		confs, err = nginxconf.ResolveByName(mainConf, filepath.Dir(mainConf), render)
+		if err != nil {
+			return Rendered{}, err
 		}
 	}
 
-	return nil
+	rendered := map[string][]byte{}
+	for _, conf := range confs {
+		rel, ok := relativePath(appDir, conf.Path)
+		if !ok {
+			continue
+		}
+
+		rendered[rel] = rewriteIncludes(conf, appDir, runtimeDir)
+	}
+
+	// The runtime directory may be a mount point, so only its contents are
+	// removed
+	entries, err := os.ReadDir(runtimeDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Rendered{}, fmt.Errorf("failed to clean runtime directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		err = os.RemoveAll(filepath.Join(runtimeDir, entry.Name()))
+		if err != nil {
+			return Rendered{}, fmt.Errorf("failed to clean runtime directory: %w", err)
+		}
+	}
+
+	err = mirror(appDir, runtimeDir, ".", rendered)
+	if err != nil {
+		return Rendered{}, fmt.Errorf("failed to write rendered config files: %w", err)
+	}
+
+	rel, _ := relativePath(appDir, mainConf)
+
+	return Rendered{
+		Conf:     filepath.Join(runtimeDir, rel),
+		Bindings: slices.Sorted(maps.Keys(bindings)),
+	}, nil
+}
+
+// resolveOptionalBinding returns the binding of the given type, as found
+// through SERVICE_BINDING_ROOT at launch, and whether there is one. There may be
+// at most one binding of the type, and it must have files for all entries.
+func resolveOptionalBinding(typ string, entries ...string) (servicebindings.Binding, bool, error) {
+	bindings, err := servicebindings.NewResolver().Resolve(typ, "", "/platform")
+	if err != nil {
+		return servicebindings.Binding{}, false, fmt.Errorf("failed to resolve binding of type %q: %w", typ, err)
+	}
+
+	if len(bindings) == 0 {
+		return servicebindings.Binding{}, false, nil
+	}
+
+	if len(bindings) > 1 {
+		return servicebindings.Binding{}, false, fmt.Errorf("found %d bindings of type %q but expected at most 1", len(bindings), typ)
+	}
+
+	for _, entry := range entries {
+		if _, ok := bindings[0].Entries[entry]; !ok || bindings[0].Path == "" {
+			return servicebindings.Binding{}, false, fmt.Errorf("binding of type '%s' does not contain required entry '%s'", typ, entry)
+		}
+	}
+
+	return bindings[0], true, nil
+}
+
+// resolveBindingEntry returns the single binding of the given type, as found
+// through SERVICE_BINDING_ROOT at launch, if it has the given entry.
+func resolveBindingEntry(typ, key string) (servicebindings.Binding, error) {
+	binding, err := servicebindings.NewResolver().ResolveOne(typ, "", "/platform")
+	if err != nil {
+		return servicebindings.Binding{}, fmt.Errorf("failed to resolve binding of type %q: %w", typ, err)
+	}
+
+	if _, ok := binding.Entries[key]; !ok {
+		return servicebindings.Binding{}, fmt.Errorf("binding of type %q has no entry %q", typ, key)
+	}
+
+	return binding, nil
 }
 
-var IncludeConfRegexp = regexp.MustCompile(`include\s+(\S*.conf);`)
+// mirror recreates dir from appDir in runtimeDir, writing the rendered files,
+// recursing into directories that contain rendered files and symlinking all
+// other entries.
+func mirror(appDir, runtimeDir, dir string, rendered map[string][]byte) error {
+	err := os.MkdirAll(filepath.Join(runtimeDir, dir), os.ModePerm)
+	if err != nil {
+		return err
+	}
 
-func getIncludedConfs(path string) ([]string, error) {
-	content, err := os.ReadFile(path)
+	entries, err := os.ReadDir(filepath.Join(appDir, dir))
 	if err != nil {
-		return nil, fmt.Errorf("could not read config file (%s): %w", path, err)
+		return err
 	}
 
-	var files []string
-	for _, match := range IncludeConfRegexp.FindAllStringSubmatch(string(content), -1) {
-		if len(match) == 2 {
-			glob := match[1]
-			if !filepath.IsAbs(glob) {
-				glob = filepath.Join(filepath.Dir(path), glob)
+	for _, entry := range entries {
+		rel := filepath.Join(dir, entry.Name())
+
+		if content, ok := rendered[rel]; ok {
+			err = os.WriteFile(filepath.Join(runtimeDir, rel), content, 0600)
+			if err != nil {
+				return err
 			}
 
-			matches, err := filepath.Glob(glob)
+			continue
+		}
+
+		if entry.IsDir() && containsRendered(rel, rendered) {
+			err = mirror(appDir, runtimeDir, rel, rendered)
 			if err != nil {
-				return nil, fmt.Errorf("failed to get 'include' files for %s: %w", glob, err)
+				return err
 			}
 
-			files = append(files, matches...)
+			continue
+		}
+
+		err = os.Symlink(filepath.Join(appDir, rel), filepath.Join(runtimeDir, rel))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func containsRendered(dir string, rendered map[string][]byte) bool {
+	for rel := range rendered {
+		if strings.HasPrefix(rel, dir+string(filepath.Separator)) {
+			return true
 		}
 	}
 
-	return files, nil
+	return false
+}
+
+// relativePath returns path relative to dir, and whether path is within dir.
+func relativePath(dir, path string) (string, bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return rel, true
+}
+
+// rewriteIncludes points the absolute includes of files within appDir at the
+// rendered copies in runtimeDir instead.
+func rewriteIncludes(conf nginxconf.File, appDir, runtimeDir string) []byte {
+	content := conf.Content
+	includes := nginxconf.Includes(conf.Directives)
+
+	// Replacing from the end keeps the spans of earlier includes valid
+	for i := len(includes) - 1; i >= 0; i-- {
+		include := includes[i]
+		rel, ok := relativePath(appDir, include.Args[0])
+		if !filepath.IsAbs(include.Args[0]) || !ok {
+			continue
+		}
+
+		span := include.Spans[0]
+		path := filepath.Join(runtimeDir, rel)
+		if quote := content[span.Start]; quote == '"' || quote == '\'' {
+			path = string(quote) + path + string(quote)
+		}
+
+		content = slices.Concat(content[:span.Start], []byte(path), content[span.End:])
+	}
+
+	return content
 }
@@ -16,7 +16,11 @@ import (
 
 func TestUnitConfigure(t *testing.T) {
 	suite := spec.New("cmd/configure/internal", spec.Report(report.Terminal{}))
+	suite("ExecDEnv", testExecDEnv)
+	suite("Resources", testResources)
 	suite("Run", testRun)
+	suite("Validate", testValidate)
+	suite("WriteRuntimeEnv", testWriteRuntimeEnv)
 	suite.Run(t)
 }
 
@@ -25,58 +29,170 @@ func testRun(t *testing.T, context spec.G, it spec.S) {
 		Expect = NewWithT(t).Expect
 
 		mainConf         string
+		resources        internal.Resources
 		localModulePath  string
 		globalModulePath string
 		workingDir       string
+		runtimeDir       string
 	)
 
 	it.Before(func() {
 		workingDir = t.TempDir()
+		runtimeDir = filepath.Join(t.TempDir(), "nginx")
 
 		mainConf = filepath.Join(workingDir, "nginx.conf")
+		resources = internal.Resources{CPUs: 4, FileLimit: 1048576}
 	})
 
 	context("when the template contains a 'port' action", func() {
 		it.Before(func() {
-			Expect(os.WriteFile(mainConf, []byte("Hi the port is {{port}}."), 0600)).To(Succeed())
+			Expect(os.WriteFile(mainConf, []byte("Hi the port is {{port}};"), 0600)).To(Succeed())
 			t.Setenv("PORT", "8080")
 		})
 
 		it("inserts the port value into that location in the text", func() {
-			err := internal.Run(mainConf, localModulePath, globalModulePath)
+			rendered, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
 			Expect(err).ToNot(HaveOccurred())
+			Expect(rendered).To(Equal(internal.Rendered{Conf: filepath.Join(runtimeDir, "nginx.conf")}))
 
-			Expect(filepath.Join(workingDir, "nginx.conf")).
-				To(matchers.BeAFileMatching("Hi the port is 8080."))
+			Expect(filepath.Join(runtimeDir, "nginx.conf")).
+				To(matchers.BeAFileMatching("Hi the port is 8080;"))
 		})
 	})
 
 	context("when the template contains a 'tempDir' action", func() {
 		it.Before(func() {
-			Expect(os.WriteFile(mainConf, []byte("Hi the tempDir is {{ tempDir }}."), 0600)).To(Succeed())
+			Expect(os.WriteFile(mainConf, []byte("Hi the tempDir is {{ tempDir }};"), 0600)).To(Succeed())
 		})
 
 		it("inserts the location of the user's temp directory into that location in the text", func() {
-			err := internal.Run(mainConf, localModulePath, globalModulePath)
+			_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(filepath.Join(workingDir, "nginx.conf")).
-				To(matchers.BeAFileMatching(fmt.Sprintf("Hi the tempDir is %s.", os.TempDir())))
+			Expect(filepath.Join(runtimeDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(fmt.Sprintf("Hi the tempDir is %s;", os.TempDir())))
 		})
 	})
 
 	context("when the template contains an 'env' action", func() {
 		it.Before(func() {
-			Expect(os.WriteFile(filepath.Join(workingDir, "nginx.conf"), []byte(`The env var FOO is {{env "FOO"}}`), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "nginx.conf"), []byte(`The env var FOO is {{env "FOO"}};`), 0600)).To(Succeed())
 			t.Setenv("FOO", "BAR")
 		})
 
 		it("inserts the env variable into that location in the text", func() {
-			err := internal.Run(mainConf, localModulePath, globalModulePath)
+			_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(filepath.Join(workingDir, "nginx.conf")).
-				To(matchers.BeAFileMatching("The env var FOO is BAR"))
+			Expect(filepath.Join(runtimeDir, "nginx.conf")).
+				To(matchers.BeAFileMatching("The env var FOO is BAR;"))
+		})
+	})
+
+	context("when the template contains 'cpus' and 'maxConnections' actions", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(mainConf, []byte("worker_processes {{ cpus }};\nworker_connections {{ maxConnections }};"), 0600)).To(Succeed())
+		})
+
+		it("inserts the values that fit the resources of the container", func() {
+			_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(filepath.Join(runtimeDir, "nginx.conf")).
+				To(matchers.BeAFileMatching("worker_processes 4;\nworker_connections 65536;"))
+		})
+
+		context("when the values are overridden", func() {
+			it.Before(func() {
+				t.Setenv("BPL_NGINX_WORKER_PROCESSES", "2")
+				t.Setenv("BPL_NGINX_WORKER_CONNECTIONS", "512")
+			})
+
+			it("inserts the overrides", func() {
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(filepath.Join(runtimeDir, "nginx.conf")).
+					To(matchers.BeAFileMatching("worker_processes 2;\nworker_connections 512;"))
+			})
+		})
+	})
+
+	context("when the template contains an 'errorLogLevel' action", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(mainConf, []byte(`error_log stderr {{ errorLogLevel }};`), 0600)).To(Succeed())
+		})
+
+		it("inserts the default level of nginx", func() {
+			_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(filepath.Join(runtimeDir, "nginx.conf")).
+				To(matchers.BeAFileMatching("error_log stderr error;"))
+		})
+
+		context("when NGINX_ERROR_LOG_LEVEL is set", func() {
+			it.Before(func() {
+				t.Setenv("NGINX_ERROR_LOG_LEVEL", "debug")
+			})
+
+			it("inserts that level", func() {
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(filepath.Join(runtimeDir, "nginx.conf")).
+					To(matchers.BeAFileMatching("error_log stderr debug;"))
+			})
+		})
+
+		context("when NGINX_ERROR_LOG_LEVEL is invalid", func() {
+			it.Before(func() {
+				t.Setenv("NGINX_ERROR_LOG_LEVEL", "verbose")
+			})
+
+			it("returns an error", func() {
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+				Expect(err).To(MatchError(ContainSubstring(`invalid NGINX_ERROR_LOG_LEVEL value "verbose": expected one of debug, info, notice, warn, error, crit, alert, emerg`)))
+			})
+		})
+	})
+
+	context("when the template contains an 'accessLogFormat' action", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(mainConf, []byte(`access_log /dev/stdout {{ accessLogFormat "combined" }};`), 0600)).To(Succeed())
+		})
+
+		it("inserts the format given at build", func() {
+			_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(filepath.Join(runtimeDir, "nginx.conf")).
+				To(matchers.BeAFileMatching("access_log /dev/stdout combined;"))
+		})
+
+		context("when the format is overridden at launch", func() {
+			it.Before(func() {
+				t.Setenv("BPL_WEB_SERVER_ACCESS_LOG_FORMAT", "json")
+			})
+
+			it("inserts the override", func() {
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(filepath.Join(runtimeDir, "nginx.conf")).
+					To(matchers.BeAFileMatching("access_log /dev/stdout json;"))
+			})
+		})
+
+		context("when the override is invalid", func() {
+			it.Before(func() {
+				t.Setenv("BPL_WEB_SERVER_ACCESS_LOG_FORMAT", "xml")
+			})
+
+			it("returns an error", func() {
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+				Expect(err).To(MatchError(ContainSubstring(`invalid BPL_WEB_SERVER_ACCESS_LOG_FORMAT value "xml": expected 'combined', 'json' or 'off'`)))
+			})
 		})
 	})
 
@@ -97,10 +213,10 @@ func testRun(t *testing.T, context spec.G, it spec.S) {
 			})
 
 			it("loads the module from the local directory", func() {
-				err := internal.Run(mainConf, localModulePath, globalModulePath)
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
 				Expect(err).ToNot(HaveOccurred())
 
-				Expect(filepath.Join(workingDir, "nginx.conf")).
+				Expect(filepath.Join(runtimeDir, "nginx.conf")).
 					To(matchers.BeAFileMatching(fmt.Sprintf("load_module %s/local.so;", localModulePath)))
 			})
 		})
@@ -111,13 +227,232 @@ func testRun(t *testing.T, context spec.G, it spec.S) {
 			})
 
 			it("loads the module from the global directory", func() {
-				err := internal.Run(mainConf, localModulePath, globalModulePath)
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
 				Expect(err).ToNot(HaveOccurred())
 
-				Expect(filepath.Join(workingDir, "nginx.conf")).
+				Expect(filepath.Join(runtimeDir, "nginx.conf")).
 					To(matchers.BeAFileMatching(fmt.Sprintf("load_module %s/global.so;", globalModulePath)))
 			})
 		})
+
+		context("when the module doesn't exist", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "nginx.conf"), []byte(`{{module "globl"}}`), 0600)).To(Succeed())
+			})
+
+			it("returns an error listing the available modules", func() {
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+				Expect(err).To(MatchError(ContainSubstring(`module "globl" not found, available modules: global, local`)))
+			})
+		})
+
+		context("when the module name is a path", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "nginx.conf"), []byte(`{{module "../global_modules/global"}}`), 0600)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+				Expect(err).To(MatchError(ContainSubstring(`invalid module name "../global_modules/global"`)))
+			})
+		})
+
+		context("when the template lists the modules", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(localModulePath, "global.so"), []byte("dummy data"), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "nginx.conf"), []byte(`# {{range modules}}{{.}} {{end}}`), 0600)).To(Succeed())
+			})
+
+			it("inserts the names of the available modules", func() {
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(filepath.Join(runtimeDir, "nginx.conf")).
+					To(matchers.BeAFileMatching("# global local "))
+			})
+		})
+
+		context("when the module is in the directory of the installed modules", func() {
+			var installedModulePath string
+
+			it.Before(func() {
+				installedModulePath = filepath.Join(workingDir, "installed_modules")
+				Expect(os.Mkdir(installedModulePath, 0744)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(installedModulePath, "installed.so"), []byte("dummy data"), 0600)).To(Succeed())
+
+				Expect(os.WriteFile(filepath.Join(workingDir, "nginx.conf"), []byte(`{{module "installed"}}`), 0600)).To(Succeed())
+			})
+
+			it("loads the module from that directory", func() {
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, installedModulePath, globalModulePath)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(filepath.Join(runtimeDir, "nginx.conf")).
+					To(matchers.BeAFileMatching(fmt.Sprintf("load_module %s/installed.so;", installedModulePath)))
+			})
+
+			context("when there are no installed modules", func() {
+				it("skips that directory", func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "nginx.conf"), []byte(`{{module "global"}}`), 0600)).To(Succeed())
+
+					_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, "", globalModulePath)
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(filepath.Join(runtimeDir, "nginx.conf")).
+						To(matchers.BeAFileMatching(fmt.Sprintf("load_module %s/global.so;", globalModulePath)))
+				})
+			})
+		})
+	})
+
+	context("when the template uses bindings", func() {
+		var bindingRoot string
+
+		it.Before(func() {
+			bindingRoot = t.TempDir()
+			Expect(os.MkdirAll(filepath.Join(bindingRoot, "upstream"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(bindingRoot, "upstream", "type"), []byte("upstream-auth"), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(bindingRoot, "upstream", "token"), []byte("some-token\n"), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(bindingRoot, "upstream", "ca.crt"), []byte("some-cert"), 0600)).To(Succeed())
+			t.Setenv("SERVICE_BINDING_ROOT", bindingRoot)
+		})
+
+		it("inserts the paths and values of the binding entries", func() {
+			Expect(os.WriteFile(mainConf, []byte(`proxy_ssl_trusted_certificate {{binding "upstream-auth" "ca.crt"}};
+proxy_set_header Authorization "Bearer {{bindingValue "upstream-auth" "token"}}";`), 0600)).To(Succeed())
+
+			rendered, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rendered).To(Equal(internal.Rendered{
+				Conf:     filepath.Join(runtimeDir, "nginx.conf"),
+				Bindings: []string{"upstream-auth"},
+			}))
+
+			Expect(filepath.Join(runtimeDir, "nginx.conf")).To(matchers.BeAFileMatching(fmt.Sprintf(`proxy_ssl_trusted_certificate %s;
+proxy_set_header Authorization "Bearer some-token";`, filepath.Join(bindingRoot, "upstream", "ca.crt"))))
+		})
+
+		context("when there is no binding of the type", func() {
+			it("returns an error", func() {
+				Expect(os.WriteFile(mainConf, []byte(`ssl_certificate {{binding "tls" "tls.crt"}};`), 0600)).To(Succeed())
+
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+				Expect(err).To(MatchError(ContainSubstring(`failed to resolve binding of type "tls": found 0 bindings`)))
+			})
+		})
+
+		context("when the binding has no such entry", func() {
+			it("returns an error", func() {
+				Expect(os.WriteFile(mainConf, []byte(`set $password {{bindingValue "upstream-auth" "password"}};`), 0600)).To(Succeed())
+
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+				Expect(err).To(MatchError(ContainSubstring(`binding of type "upstream-auth" has no entry "password"`)))
+			})
+		})
+	})
+
+	context("when the template contains an 'htpasswd' action", func() {
+		var bindingRoot string
+
+		it.Before(func() {
+			bindingRoot = t.TempDir()
+			t.Setenv("SERVICE_BINDING_ROOT", bindingRoot)
+
+			Expect(os.WriteFile(mainConf, []byte(`{{- with htpasswd }}auth_basic_user_file {{ . }};{{- end }}`), 0600)).To(Succeed())
+		})
+
+		context("when there is an htpasswd binding", func() {
+			it.Before(func() {
+				Expect(os.MkdirAll(filepath.Join(bindingRoot, "auth"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(bindingRoot, "auth", "type"), []byte("htpasswd"), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(bindingRoot, "auth", ".htpasswd"), []byte("user:password"), 0600)).To(Succeed())
+			})
+
+			it("inserts the path of the .htpasswd file", func() {
+				rendered, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(rendered.Bindings).To(Equal([]string{"htpasswd"}))
+
+				Expect(filepath.Join(runtimeDir, "nginx.conf")).
+					To(matchers.BeAFileMatching(fmt.Sprintf("auth_basic_user_file %s;", filepath.Join(bindingRoot, "auth", ".htpasswd"))))
+			})
+		})
+
+		context("when there is no htpasswd binding", func() {
+			it("renders nothing", func() {
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(filepath.Join(runtimeDir, "nginx.conf")).To(matchers.BeAFileMatching(""))
+			})
+		})
+
+		context("when the htpasswd binding has no .htpasswd entry", func() {
+			it.Before(func() {
+				Expect(os.MkdirAll(filepath.Join(bindingRoot, "auth"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(bindingRoot, "auth", "type"), []byte("htpasswd"), 0600)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+				Expect(err).To(MatchError(ContainSubstring("binding of type 'htpasswd' does not contain required entry '.htpasswd'")))
+			})
+		})
+
+		context("when there is more than one htpasswd binding", func() {
+			it.Before(func() {
+				for _, name := range []string{"auth", "other-auth"} {
+					Expect(os.MkdirAll(filepath.Join(bindingRoot, name), os.ModePerm)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(bindingRoot, name, "type"), []byte("htpasswd"), 0600)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(bindingRoot, name, ".htpasswd"), []byte("user:password"), 0600)).To(Succeed())
+				}
+			})
+
+			it("returns an error", func() {
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+				Expect(err).To(MatchError(ContainSubstring(`found 2 bindings of type "htpasswd" but expected at most 1`)))
+			})
+		})
+	})
+
+	context("when the template contains a 'tls' action", func() {
+		var bindingRoot string
+
+		it.Before(func() {
+			bindingRoot = t.TempDir()
+			t.Setenv("SERVICE_BINDING_ROOT", bindingRoot)
+
+			Expect(os.MkdirAll(filepath.Join(bindingRoot, "cert"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(bindingRoot, "cert", "type"), []byte("tls"), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(bindingRoot, "cert", "tls.crt"), []byte("some-certificate"), 0600)).To(Succeed())
+
+			Expect(os.WriteFile(mainConf, []byte(`{{- with tls }}ssl_certificate {{ .Certificate }}; ssl_certificate_key {{ .Key }};{{- end }}`), 0600)).To(Succeed())
+		})
+
+		context("when there is a tls binding", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(bindingRoot, "cert", "tls.key"), []byte("some-key"), 0600)).To(Succeed())
+			})
+
+			it("inserts the paths of the certificate and key", func() {
+				rendered, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(rendered.Bindings).To(Equal([]string{"tls"}))
+
+				Expect(filepath.Join(runtimeDir, "nginx.conf")).
+					To(matchers.BeAFileMatching(fmt.Sprintf("ssl_certificate %s; ssl_certificate_key %s;",
+						filepath.Join(bindingRoot, "cert", "tls.crt"),
+						filepath.Join(bindingRoot, "cert", "tls.key"),
+					)))
+			})
+		})
+
+		context("when the tls binding has no tls.key entry", func() {
+			it("returns an error", func() {
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+				Expect(err).To(MatchError(ContainSubstring("binding of type 'tls' does not contain required entry 'tls.key'")))
+			})
+		})
 	})
 
 	context("when the template uses include files", func() {
@@ -132,16 +467,18 @@ func testRun(t *testing.T, context spec.G, it spec.S) {
 	keepalive_timeout 30;
 	port_in_redirect off; # Ensure that redirects don't include the internal container PORT - 8080
 	}`), 0600)).To(Succeed())
-				Expect(os.WriteFile(filepath.Join(workingDir, "custom.conf"), []byte(`Hi the port is {{ port }}.`), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "custom.conf"), []byte(`Hi the port is {{ port }};`), 0600)).To(Succeed())
 				t.Setenv("PORT", "8080")
 			})
 
 			it("parses 'include' file and interpolates values", func() {
-				err := internal.Run(mainConf, localModulePath, globalModulePath)
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
 				Expect(err).ToNot(HaveOccurred())
 
+				Expect(filepath.Join(runtimeDir, "custom.conf")).
+					To(matchers.BeAFileMatching("Hi the port is 8080;"))
 				Expect(filepath.Join(workingDir, "custom.conf")).
-					To(matchers.BeAFileMatching("Hi the port is 8080."))
+					To(matchers.BeAFileMatching("Hi the port is {{ port }};"))
 			})
 		})
 
@@ -157,24 +494,50 @@ func testRun(t *testing.T, context spec.G, it spec.S) {
 		keepalive_timeout 30;
 		port_in_redirect off; # Ensure that redirects don't include the internal container PORT - 8080
 		}`), 0600)).To(Succeed())
-				Expect(os.WriteFile(filepath.Join(workingDir, "dontFix.conf"), []byte(`Hi the port is {{ port }}.`), 0600)).To(Succeed())
-				Expect(os.WriteFile(filepath.Join(workingDir, "subdir", "custom1.conf"), []byte(`Hi the port is {{ port }}.`), 0600)).To(Succeed())
-				Expect(os.WriteFile(filepath.Join(workingDir, "subdir", "custom2.conf"), []byte(`Hi the port is {{ port }}.`), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "dontFix.conf"), []byte(`Hi the port is {{ port }};`), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "subdir", "custom1.conf"), []byte(`Hi the port is {{ port }};`), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "subdir", "custom2.conf"), []byte(`Hi the port is {{ port }};`), 0600)).To(Succeed())
 				t.Setenv("PORT", "8080")
 			})
 
 			it("parses 'include' files and interpolates values into all files that match the mask", func() {
-				err := internal.Run(mainConf, localModulePath, globalModulePath)
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
 				Expect(err).ToNot(HaveOccurred())
 
-				Expect(filepath.Join(workingDir, "dontFix.conf")).
-					To(matchers.BeAFileMatching(`Hi the port is {{ port }}.`))
+				Expect(filepath.Join(runtimeDir, "dontFix.conf")).
+					To(matchers.BeAFileMatching(`Hi the port is {{ port }};`))
 
-				Expect(filepath.Join(workingDir, "subdir", "custom1.conf")).
-					To(matchers.BeAFileMatching(`Hi the port is 8080.`))
+				Expect(filepath.Join(runtimeDir, "subdir", "custom1.conf")).
+					To(matchers.BeAFileMatching(`Hi the port is 8080;`))
 
-				Expect(filepath.Join(workingDir, "subdir", "custom2.conf")).
-					To(matchers.BeAFileMatching(`Hi the port is 8080.`))
+				Expect(filepath.Join(runtimeDir, "subdir", "custom2.conf")).
+					To(matchers.BeAFileMatching(`Hi the port is 8080;`))
+			})
+		})
+
+		context("when the configuration can't be parsed", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "nginx.conf"), []byte(`http {
+  include custom.conf;
+  server {
+    listen {{ port }};
+    location / {
+      content_by_lua_block { ngx.say("}") }
+    }
+  }
+}`), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "custom.conf"), []byte(`Hi the port is {{ port }};`), 0600)).To(Succeed())
+				t.Setenv("PORT", "8080")
+			})
+
+			it("finds the included files by name and interpolates values", func() {
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(filepath.Join(runtimeDir, "nginx.conf")).
+					To(matchers.BeAFileMatching(ContainSubstring("listen 8080;")))
+				Expect(filepath.Join(runtimeDir, "custom.conf")).
+					To(matchers.BeAFileMatching("Hi the port is 8080;"))
 			})
 		})
 	})
@@ -185,32 +548,130 @@ func testRun(t *testing.T, context spec.G, it spec.S) {
 		})
 
 		it("does nothing", func() {
-			err := internal.Run(mainConf, localModulePath, globalModulePath)
+			rendered, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
 			Expect(err).NotTo(HaveOccurred())
+			Expect(rendered).To(Equal(internal.Rendered{}))
 		})
 	})
 
-	context("when the template does not need to be overwritten", func() {
+	context("when the app dir is read-only", func() {
 		it.Before(func() {
-			Expect(os.WriteFile(filepath.Join(workingDir, "nginx.conf"), []byte(`listen 1234;`), 0600)).To(Succeed())
-			Expect(os.Chmod(filepath.Join(workingDir, "nginx.conf"), 0440)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "nginx.conf"), []byte(`listen {{port}};`), 0400)).To(Succeed())
+			Expect(os.Mkdir(filepath.Join(workingDir, "public"), os.ModePerm)).To(Succeed())
+			Expect(os.Chmod(workingDir, 0500)).To(Succeed())
+			t.Setenv("PORT", "8080")
+		})
+
+		it.After(func() {
+			Expect(os.Chmod(workingDir, os.ModePerm)).To(Succeed())
 		})
 
-		it("does not overwrite it with the same contents", func() {
-			err := internal.Run(filepath.Join(workingDir, "nginx.conf"), localModulePath, globalModulePath)
+		it("leaves the template untouched and links the other files into the runtime dir", func() {
+			_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).To(matchers.BeAFileMatching("listen {{port}};"))
+			Expect(filepath.Join(runtimeDir, "nginx.conf")).To(matchers.BeAFileMatching("listen 8080;"))
+
+			link, err := os.Readlink(filepath.Join(runtimeDir, "public"))
 			Expect(err).NotTo(HaveOccurred())
+			Expect(link).To(Equal(filepath.Join(workingDir, "public")))
+		})
+
+		context("when it is run again with a different environment", func() {
+			it("renders the template again", func() {
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+				Expect(err).NotTo(HaveOccurred())
+
+				t.Setenv("PORT", "9090")
+				_, err = internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(filepath.Join(runtimeDir, "nginx.conf")).To(matchers.BeAFileMatching("listen 9090;"))
+			})
+		})
+	})
+
+	context("when the template includes files by absolute path", func() {
+		it.Before(func() {
+			Expect(os.MkdirAll(filepath.Join(workingDir, "conf.d"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "conf.d", "port.conf"), []byte(`listen {{port}};`), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "conf.d", "mime.types"), []byte(`types {}`), 0600)).To(Succeed())
+			Expect(os.WriteFile(mainConf, []byte(fmt.Sprintf("include %s/conf.d/*.conf;\ninclude /etc/nginx/other.conf;", workingDir)), 0600)).To(Succeed())
+			t.Setenv("PORT", "8080")
+		})
+
+		it("points the includes within the app dir at the rendered files", func() {
+			_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(runtimeDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(fmt.Sprintf("include %s/conf.d/*.conf;\ninclude /etc/nginx/other.conf;", runtimeDir)))
+			Expect(filepath.Join(runtimeDir, "conf.d", "port.conf")).To(matchers.BeAFileMatching("listen 8080;"))
+
+			link, err := os.Readlink(filepath.Join(runtimeDir, "conf.d", "mime.types"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link).To(Equal(filepath.Join(workingDir, "conf.d", "mime.types")))
+		})
+	})
+
+	context("when included files include other files", func() {
+		it.Before(func() {
+			Expect(os.MkdirAll(filepath.Join(workingDir, "conf.d"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(mainConf, []byte(`http { include conf.d/server.conf; }`), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "conf.d", "server.conf"), []byte(fmt.Sprintf(`server {
+  include conf.d/listen;
+  # include conf.d/commented.conf;
+  include "%s/conf.d/root.conf";
+}`, workingDir)), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "conf.d", "listen"), []byte(`listen {{port}};`), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "conf.d", "root.conf"), []byte(`root {{env "ROOT"}};`), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "conf.d", "commented.conf"), []byte(`listen {{port}};`), 0600)).To(Succeed())
+			t.Setenv("PORT", "8080")
+			t.Setenv("ROOT", "/workspace/public")
+		})
+
+		it("renders them relative to the prefix, skipping commented out includes", func() {
+			_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(runtimeDir, "conf.d", "server.conf")).To(matchers.BeAFileMatching(fmt.Sprintf(`server {
+  include conf.d/listen;
+  # include conf.d/commented.conf;
+  include "%s/conf.d/root.conf";
+}`, runtimeDir)))
+			Expect(filepath.Join(runtimeDir, "conf.d", "listen")).To(matchers.BeAFileMatching("listen 8080;"))
+			Expect(filepath.Join(runtimeDir, "conf.d", "root.conf")).To(matchers.BeAFileMatching("root /workspace/public;"))
+
+			link, err := os.Readlink(filepath.Join(runtimeDir, "conf.d", "commented.conf"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link).To(Equal(filepath.Join(workingDir, "conf.d", "commented.conf")))
 		})
 	})
 
 	context("failure cases", func() {
-		context("when the template file cannot be written", func() {
+		context("when the runtime dir cannot be written", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "nginx.conf"), []byte(`listen {{port}};`), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "file"), nil, 0600)).To(Succeed())
+				runtimeDir = filepath.Join(workingDir, "file", "nginx")
+			})
+
+			it("prints an error and exits non-zero", func() {
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+				Expect(err).To(MatchError(MatchRegexp("failed to (clean runtime directory|write rendered config files): .*: not a directory")))
+			})
+		})
+
+		context("when the template is outside of the app dir", func() {
 			it.Before(func() {
-				Expect(os.WriteFile(filepath.Join(workingDir, "nginx.conf"), []byte(`{{module "global"}}`), 0444)).To(Succeed())
+				mainConf = filepath.Join(t.TempDir(), "nginx.conf")
+				Expect(os.WriteFile(mainConf, []byte(`listen 8080;`), 0600)).To(Succeed())
 			})
 
 			it("prints an error and exits non-zero", func() {
-				err := internal.Run(mainConf, localModulePath, globalModulePath)
-				Expect(err).To(MatchError(MatchRegexp("failed to overwrite template: .*: permission denied")))
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
+				Expect(err).To(MatchError(fmt.Sprintf("config file %s must be within the app dir %s", mainConf, workingDir)))
 			})
 		})
 
@@ -220,7 +681,7 @@ func testRun(t *testing.T, context spec.G, it spec.S) {
 			})
 
 			it("prints an error and exits non-zero", func() {
-				err := internal.Run(mainConf, localModulePath, globalModulePath)
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
 				Expect(err).To(MatchError(MatchRegexp("failed to execute template: .*: wrong number of args for port: want 0 got 1")))
 			})
 		})
@@ -231,7 +692,7 @@ func testRun(t *testing.T, context spec.G, it spec.S) {
 			})
 
 			it("prints an error and exits non-zero", func() {
-				err := internal.Run(mainConf, localModulePath, globalModulePath)
+				_, err := internal.Run(mainConf, workingDir, runtimeDir, resources, localModulePath, globalModulePath)
 				Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf("failed to get 'include' files for %s", workingDir))))
 				Expect(err).To(MatchError(ContainSubstring(`/\/\/.conf: syntax error in pattern`)))
 			})
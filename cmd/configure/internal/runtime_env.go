@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WriteRuntimeEnv writes the environment variables whose names start with
+// prefix to path, so that apps built once can be configured at launch. A path
+// ending in .json holds a JSON object, any other path a script that assigns the
+// object to window.__ENV__.
+func WriteRuntimeEnv(path, prefix string, environ []string) error {
+	if path == "" || prefix == "" {
+		return nil
+	}
+
+	variables := map[string]string{}
+	for _, variable := range environ {
+		name, value, _ := strings.Cut(variable, "=")
+		if strings.HasPrefix(name, prefix) {
+			variables[name] = value
+		}
+	}
+
+	content, err := json.Marshal(variables)
+	if err != nil {
+		// not tested
+		return err
+	}
+
+	if filepath.Ext(path) != ".json" {
+		content = fmt.Appendf(nil, "window.__ENV__ = %s;", content)
+	}
+	content = append(content, '\n')
+
+	err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to write runtime environment: %w", err)
+	}
+
+	err = os.WriteFile(path, content, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write runtime environment: %w", err)
+	}
+
+	// A precompressed copy would be served instead of the file
+	for _, extension := range []string{".gz", ".br"} {
+		err = os.Remove(path + extension)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove precompressed runtime environment: %w", err)
+		}
+	}
+
+	return nil
+}
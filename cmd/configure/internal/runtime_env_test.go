@@ -0,0 +1,93 @@
+package internal_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paketo-buildpacks/nginx/cmd/configure/internal"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testWriteRuntimeEnv(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		root    string
+		environ []string
+	)
+
+	it.Before(func() {
+		root = t.TempDir()
+		environ = []string{
+			"PUBLIC_API_URL=https://api.example.com/?a=1&b=2",
+			`PUBLIC_GREETING=say "hi" </script>`,
+			"SECRET_TOKEN=hunter2",
+		}
+	})
+
+	it("writes a script that exposes the variables with the prefix", func() {
+		err := internal.WriteRuntimeEnv(filepath.Join(root, "env.js"), "PUBLIC_", environ)
+		Expect(err).NotTo(HaveOccurred())
+
+		content, err := os.ReadFile(filepath.Join(root, "env.js"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal(`window.__ENV__ = {"PUBLIC_API_URL":"https://api.example.com/?a=1\u0026b=2","PUBLIC_GREETING":"say \"hi\" \u003c/script\u003e"};` + "\n"))
+	})
+
+	context("when the file is a .json file", func() {
+		it("writes a JSON object", func() {
+			err := internal.WriteRuntimeEnv(filepath.Join(root, "env.json"), "PUBLIC_API", environ)
+			Expect(err).NotTo(HaveOccurred())
+
+			content, err := os.ReadFile(filepath.Join(root, "env.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal(`{"PUBLIC_API_URL":"https://api.example.com/?a=1\u0026b=2"}` + "\n"))
+		})
+	})
+
+	context("when precompressed copies exist", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(root, "env.js.gz"), []byte("stale"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(root, "env.js.br"), []byte("stale"), 0644)).To(Succeed())
+		})
+
+		it("removes them", func() {
+			err := internal.WriteRuntimeEnv(filepath.Join(root, "env.js"), "PUBLIC_", environ)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filepath.Join(root, "env.js.gz")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(root, "env.js.br")).NotTo(BeAnExistingFile())
+		})
+	})
+
+	context("when the directory does not exist", func() {
+		it("creates it", func() {
+			err := internal.WriteRuntimeEnv(filepath.Join(root, "runtime-env", "env.js"), "PUBLIC_", environ)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filepath.Join(root, "runtime-env", "env.js")).To(BeAnExistingFile())
+		})
+	})
+
+	context("when no prefix is set", func() {
+		it("does not write the file", func() {
+			err := internal.WriteRuntimeEnv(filepath.Join(root, "env.js"), "", environ)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filepath.Join(root, "env.js")).NotTo(BeAnExistingFile())
+		})
+	})
+
+	context("failure cases", func() {
+		context("when the file cannot be written", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(root, "file"), nil, 0644)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				err := internal.WriteRuntimeEnv(filepath.Join(root, "file", "env.js"), "PUBLIC_", environ)
+				Expect(err).To(MatchError(ContainSubstring("failed to write runtime environment")))
+			})
+		})
+	})
+}
@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2/pexec"
+)
+
+// ConfigErrorContextLines is the number of lines shown before and after the
+// line that nginx reports as invalid.
+const ConfigErrorContextLines = 3
+
+var configErrorRegexp = regexp.MustCompile(` in (\S+):(\d+)`)
+
+// Validate tests the rendered configuration with `nginx -t`, using the same
+// arguments as the launch process, so that mistakes are reported before nginx
+// starts. On failure, the returned error holds the output of nginx and the
+// lines around the reported location.
+func Validate(nginxPath, prefix, mainConf string) error {
+	if _, err := os.Stat(mainConf); err != nil {
+		return nil
+	}
+
+	output := bytes.NewBuffer(nil)
+	err := pexec.NewExecutable(nginxPath).Execute(pexec.Execution{
+		Args: []string{
+			"-t", "-q",
+			"-e", "stderr",
+			"-p", prefix,
+			"-c", mainConf,
+			"-g", "pid /tmp/nginx.pid;",
+		},
+		Stdout: output,
+		Stderr: output,
+	})
+	if err == nil {
+		return nil
+	}
+
+	message := fmt.Sprintf("nginx configuration test failed: %s\n%s", err, strings.TrimSpace(output.String()))
+	if match := configErrorRegexp.FindStringSubmatch(output.String()); match != nil {
+		line, _ := strconv.Atoi(match[2])
+		if excerpt := configExcerpt(match[1], line); excerpt != "" {
+			message += "\n\n" + excerpt
+		}
+	}
+
+	return errors.New(message)
+}
+
+func configExcerpt(path string, line int) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	lines := strings.Split(string(content), "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+
+	first, last := max(line-ConfigErrorContextLines, 1), min(line+ConfigErrorContextLines, len(lines))
+	width := len(strconv.Itoa(last))
+
+	excerpt := []string{fmt.Sprintf("%s:%d:", path, line)}
+	for i := first; i <= last; i++ {
+		marker := " "
+		if i == line {
+			marker = ">"
+		}
+
+		excerpt = append(excerpt, fmt.Sprintf("%s %*d | %s", marker, width, i, lines[i-1]))
+	}
+
+	return strings.Join(excerpt, "\n")
+}
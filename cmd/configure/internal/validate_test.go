@@ -0,0 +1,84 @@
+package internal_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/paketo-buildpacks/nginx/cmd/configure/internal"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testValidate(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+		mainConf   string
+		nginxPath  string
+	)
+
+	it.Before(func() {
+		workingDir = t.TempDir()
+		mainConf = filepath.Join(workingDir, "nginx.conf")
+		nginxPath = filepath.Join(t.TempDir(), "nginx")
+
+		var lines []string
+		for i := 1; i <= 10; i++ {
+			lines = append(lines, fmt.Sprintf("line %d;", i))
+		}
+		Expect(os.WriteFile(mainConf, []byte(strings.Join(lines, "\n")), 0600)).To(Succeed())
+	})
+
+	context("when the configuration is valid", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(nginxPath, []byte(fmt.Sprintf("#!/bin/sh\necho \"$@\" > %s\n", filepath.Join(workingDir, "args"))), 0755)).To(Succeed())
+		})
+
+		it("tests it with the arguments of the launch process", func() {
+			err := internal.Validate(nginxPath, workingDir, mainConf)
+			Expect(err).NotTo(HaveOccurred())
+
+			args, err := os.ReadFile(filepath.Join(workingDir, "args"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(args)).To(Equal(fmt.Sprintf("-t -q -e stderr -p %s -c %s -g pid /tmp/nginx.pid;\n", workingDir, mainConf)))
+		})
+	})
+
+	context("when the configuration is invalid", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(nginxPath, []byte(fmt.Sprintf(`#!/bin/sh
+echo 'nginx: [emerg] unknown directive "line" in %s:5' >&2
+echo 'nginx: configuration file %[1]s test failed' >&2
+exit 1
+`, mainConf)), 0755)).To(Succeed())
+		})
+
+		it("returns an error with the lines around the reported location", func() {
+			err := internal.Validate(nginxPath, workingDir, mainConf)
+			Expect(err).To(MatchError(fmt.Sprintf(`nginx configuration test failed: exit status 1
+nginx: [emerg] unknown directive "line" in %[1]s:5
+nginx: configuration file %[1]s test failed
+
+%[1]s:5:
+  2 | line 2;
+  3 | line 3;
+  4 | line 4;
+> 5 | line 5;
+  6 | line 6;
+  7 | line 7;
+  8 | line 8;`, mainConf)))
+		})
+	})
+
+	context("when there is no configuration", func() {
+		it("does not test it", func() {
+			err := internal.Validate(filepath.Join(workingDir, "missing-nginx"), workingDir, filepath.Join(workingDir, "missing.conf"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+}
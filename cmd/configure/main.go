@@ -4,7 +4,9 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/paketo-buildpacks/nginx/cmd/configure/internal"
 )
@@ -12,18 +14,94 @@ import (
 func main() {
 	log.SetFlags(0)
 
+	// Checked before any file is opened, which could take the descriptor
+	// otherwise
+	execd := hasExecDFile()
+
 	wd, err := os.Getwd()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = internal.Run(
-		os.Getenv("EXECD_CONF"),
+	mainConf := os.Getenv("EXECD_CONF")
+	runtimeDir := os.Getenv("EXECD_RUNTIME_DIR")
+
+	resources, err := internal.LoadResources("/sys/fs/cgroup")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rendered, err := internal.Run(
+		mainConf,
+		wd,
+		runtimeDir,
+		resources,
 		filepath.Join(wd, "modules"),
+		os.Getenv("EXECD_MODULES_DIR"),
 		strings.Replace(filepath.Dir(os.Args[0]), "exec.d", "modules", 1),
 	)
 
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	if skip, _ := strconv.ParseBool(os.Getenv("BPL_NGINX_SKIP_CONFIG_TEST")); !skip {
+		err = internal.Validate(
+			filepath.Join(strings.Replace(filepath.Dir(os.Args[0]), "exec.d", "sbin", 1), "nginx"),
+			runtimeDir,
+			rendered.Conf,
+		)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	err = internal.WriteRuntimeEnv(
+		os.Getenv("EXECD_RUNTIME_ENV_FILE"),
+		os.Getenv("EXECD_RUNTIME_ENV_PREFIX"),
+		os.Environ(),
+	)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	env, err := internal.ExecDEnv(rendered, runtimeDir, resources)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if execd {
+		err = internal.WriteExecDEnv(os.NewFile(3, "/dev/fd/3"), env)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// hasExecDFile reports whether the launcher opened file descriptor 3 to read
+// the environment computed by exec.d binaries. When the binary runs on its
+// own, e.g. from the launcher of the live reload process, the Go runtime
+// takes the free descriptor before main runs, for its poller or to read the
+// cgroup CPU limit, neither of which is a pipe, socket or file open for
+// writing.
+func hasExecDFile() bool {
+	var stat syscall.Stat_t
+	if err := syscall.Fstat(3, &stat); err != nil {
+		return false
+	}
+
+	switch stat.Mode & syscall.S_IFMT {
+	case syscall.S_IFIFO, syscall.S_IFSOCK, syscall.S_IFREG:
+	default:
+		return false
+	}
+
+	flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, 3, syscall.F_GETFL, 0)
+	if errno != 0 {
+		return false
+	}
+
+	return flags&syscall.O_ACCMODE != syscall.O_RDONLY
 }
@@ -0,0 +1,84 @@
+package main_test
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/onsi/gomega/gexec"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestUnitConfigureBinary(t *testing.T) {
+	suite := spec.New("cmd/configure", spec.Report(report.Terminal{}))
+	suite("Main", testMain)
+	suite.Run(t)
+}
+
+func testMain(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		binary     string
+		workingDir string
+		runtimeDir string
+		command    *exec.Cmd
+	)
+
+	it.Before(func() {
+		var err error
+		binary, err = gexec.Build("github.com/paketo-buildpacks/nginx/cmd/configure")
+		Expect(err).NotTo(HaveOccurred())
+
+		workingDir = t.TempDir()
+		runtimeDir = filepath.Join(t.TempDir(), "nginx")
+		Expect(os.WriteFile(filepath.Join(workingDir, "nginx.conf"), []byte("http { server { listen {{port}}; } }"), 0600)).To(Succeed())
+
+		command = exec.Command(binary)
+		command.Dir = workingDir
+		command.Env = append(os.Environ(),
+			"EXECD_CONF="+filepath.Join(workingDir, "nginx.conf"),
+			"EXECD_RUNTIME_DIR="+runtimeDir,
+			"PORT=8080",
+			"BPL_NGINX_SKIP_CONFIG_TEST=true",
+		)
+	})
+
+	it.After(func() {
+		gexec.CleanupBuildArtifacts()
+	})
+
+	it("writes the exec.d environment to file descriptor 3", func() {
+		reader, writer, err := os.Pipe()
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+
+		command.ExtraFiles = []*os.File{writer}
+		output, err := command.CombinedOutput()
+		Expect(err).NotTo(HaveOccurred(), string(output))
+		Expect(writer.Close()).To(Succeed())
+
+		var env bytes.Buffer
+		_, err = env.ReadFrom(reader)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env.String()).To(ContainSubstring(`PORT = "8080"`))
+
+		Expect(filepath.Join(runtimeDir, "nginx.conf")).To(BeAnExistingFile())
+	})
+
+	context("when it runs on its own, without file descriptor 3", func() {
+		it("renders the configuration without writing the exec.d environment", func() {
+			output, err := command.CombinedOutput()
+			Expect(err).NotTo(HaveOccurred(), string(output))
+
+			content, err := os.ReadFile(filepath.Join(runtimeDir, "nginx.conf"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal("http { server { listen 8080; } }"))
+		})
+	})
+}
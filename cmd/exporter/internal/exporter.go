@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// StubStatus holds the counters that the nginx stub_status module reports.
+type StubStatus struct {
+	Active   int64
+	Accepted int64
+	Handled  int64
+	Requests int64
+	Reading  int64
+	Writing  int64
+	Waiting  int64
+}
+
+// ParseStubStatus parses the text served by the stub_status module:
+//
+//	Active connections: 291
+//	server accepts handled requests
+//	 16630948 16630948 31070465
+//	Reading: 6 Writing: 179 Waiting: 106
+func ParseStubStatus(r io.Reader) (StubStatus, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return StubStatus{}, err
+	}
+
+	var status StubStatus
+	fields := strings.Fields(string(content))
+	_, err = fmt.Sscanf(strings.Join(fields, " "),
+		"Active connections: %d server accepts handled requests %d %d %d Reading: %d Writing: %d Waiting: %d",
+		&status.Active, &status.Accepted, &status.Handled, &status.Requests, &status.Reading, &status.Writing, &status.Waiting,
+	)
+	if err != nil {
+		return StubStatus{}, fmt.Errorf("failed to parse stub_status response: %w", err)
+	}
+
+	return status, nil
+}
+
+// Handler serves the counters of the stub_status endpoint at url in the
+// Prometheus text format, scraping the endpoint on every request. When nginx
+// can't be scraped, only nginx_up is reported, as 0.
+func Handler(url string, client *http.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		status, err := scrape(url, client)
+		if err != nil {
+			log.Printf("failed to scrape %s: %s", url, err)
+			writeMetric(w, "nginx_up", "gauge", "Whether the stub_status endpoint of nginx could be scraped.", 0)
+			return
+		}
+
+		writeMetric(w, "nginx_up", "gauge", "Whether the stub_status endpoint of nginx could be scraped.", 1)
+		writeMetric(w, "nginx_connections_active", "gauge", "Active client connections.", status.Active)
+		writeMetric(w, "nginx_connections_accepted", "counter", "Accepted client connections.", status.Accepted)
+		writeMetric(w, "nginx_connections_handled", "counter", "Handled client connections.", status.Handled)
+		writeMetric(w, "nginx_connections_reading", "gauge", "Connections where nginx is reading the request header.", status.Reading)
+		writeMetric(w, "nginx_connections_writing", "gauge", "Connections where nginx is writing the response back to the client.", status.Writing)
+		writeMetric(w, "nginx_connections_waiting", "gauge", "Idle client connections waiting for a request.", status.Waiting)
+		writeMetric(w, "nginx_http_requests_total", "counter", "Total client requests.", status.Requests)
+	})
+}
+
+func scrape(url string, client *http.Client) (StubStatus, error) {
+	response, err := client.Get(url)
+	if err != nil {
+		return StubStatus{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return StubStatus{}, fmt.Errorf("unexpected response status: %s", response.Status)
+	}
+
+	return ParseStubStatus(response.Body)
+}
+
+func writeMetric(w io.Writer, name, typ, help string, value int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, typ, name, value)
+}
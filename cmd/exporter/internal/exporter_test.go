@@ -0,0 +1,113 @@
+package internal_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/paketo-buildpacks/nginx/cmd/exporter/internal"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestUnitExporter(t *testing.T) {
+	suite := spec.New("cmd/exporter/internal", spec.Report(report.Terminal{}))
+	suite("Handler", testHandler)
+	suite("ParseStubStatus", testParseStubStatus)
+	suite.Run(t)
+}
+
+const stubStatus = `Active connections: 291 
+server accepts handled requests
+ 16630948 16630947 31070465 
+Reading: 6 Writing: 179 Waiting: 106 
+`
+
+func testParseStubStatus(t *testing.T, context spec.G, it spec.S) {
+	var Expect = NewWithT(t).Expect
+
+	it("parses the counters", func() {
+		status, err := internal.ParseStubStatus(strings.NewReader(stubStatus))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(Equal(internal.StubStatus{
+			Active:   291,
+			Accepted: 16630948,
+			Handled:  16630947,
+			Requests: 31070465,
+			Reading:  6,
+			Writing:  179,
+			Waiting:  106,
+		}))
+	})
+
+	context("failure cases", func() {
+		context("when the response isn't stub_status output", func() {
+			it("returns an error", func() {
+				_, err := internal.ParseStubStatus(strings.NewReader("<html>Not Found</html>"))
+				Expect(err).To(MatchError(ContainSubstring("failed to parse stub_status response")))
+			})
+		})
+	})
+}
+
+func testHandler(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		nginx *httptest.Server
+	)
+
+	it.Before(func() {
+		nginx = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/stub_status" {
+				http.NotFound(w, req)
+				return
+			}
+
+			fmt.Fprint(w, stubStatus)
+		}))
+	})
+
+	it.After(func() {
+		nginx.Close()
+	})
+
+	get := func(url string) string {
+		recorder := httptest.NewRecorder()
+		internal.Handler(url, nginx.Client()).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Header().Get("Content-Type")).To(HavePrefix("text/plain; version=0.0.4"))
+
+		body, err := io.ReadAll(recorder.Body)
+		Expect(err).NotTo(HaveOccurred())
+
+		return string(body)
+	}
+
+	it("serves the counters in the Prometheus text format", func() {
+		body := get(nginx.URL + "/stub_status")
+
+		Expect(body).To(ContainSubstring("# TYPE nginx_up gauge\nnginx_up 1\n"))
+		Expect(body).To(ContainSubstring("# TYPE nginx_connections_active gauge\nnginx_connections_active 291\n"))
+		Expect(body).To(ContainSubstring("# TYPE nginx_connections_accepted counter\nnginx_connections_accepted 16630948\n"))
+		Expect(body).To(ContainSubstring("# TYPE nginx_connections_handled counter\nnginx_connections_handled 16630947\n"))
+		Expect(body).To(ContainSubstring("# TYPE nginx_connections_reading gauge\nnginx_connections_reading 6\n"))
+		Expect(body).To(ContainSubstring("# TYPE nginx_connections_writing gauge\nnginx_connections_writing 179\n"))
+		Expect(body).To(ContainSubstring("# TYPE nginx_connections_waiting gauge\nnginx_connections_waiting 106\n"))
+		Expect(body).To(ContainSubstring("# TYPE nginx_http_requests_total counter\nnginx_http_requests_total 31070465\n"))
+	})
+
+	context("when nginx can't be scraped", func() {
+		it("reports that nginx is down", func() {
+			body := get(nginx.URL + "/missing")
+
+			Expect(body).To(Equal("# HELP nginx_up Whether the stub_status endpoint of nginx could be scraped.\n# TYPE nginx_up gauge\nnginx_up 0\n"))
+		})
+	})
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/paketo-buildpacks/nginx/cmd/exporter/internal"
+)
+
+func main() {
+	log.SetFlags(0)
+
+	stubStatusURL := flag.String("stub-status-url", "http://127.0.0.1:8083/stub_status", "URL of the nginx stub_status endpoint")
+	flag.Parse()
+
+	port := os.Getenv("BPL_NGINX_METRICS_PORT")
+	if port == "" {
+		port = "9113"
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", internal.Handler(*stubStatusURL, &http.Client{Timeout: 5 * time.Second}))
+
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	log.Printf("Serving metrics of %s on port %s at /metrics", *stubStatusURL, port)
+	log.Fatal(server.ListenAndServe())
+}
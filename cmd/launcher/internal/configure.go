@@ -0,0 +1,22 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// Configure runs the configure binary at path on its own, so that the
+// templates in nginx.conf are rendered again before nginx restarts, e.g. after
+// a live reload changed them.
+func Configure(path string) error {
+	cmd := exec.Command(path)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("failed to run %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package internal_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paketo-buildpacks/nginx/cmd/launcher/internal"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testConfigure(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		dir string
+	)
+
+	it.Before(func() {
+		dir = t.TempDir()
+	})
+
+	it("runs the configure binary", func() {
+		path := filepath.Join(dir, "configure")
+		Expect(os.WriteFile(path, []byte("#!/bin/sh\ntouch \""+filepath.Join(dir, "configured")+"\"\n"), 0755)).To(Succeed())
+
+		Expect(internal.Configure(path)).To(Succeed())
+		Expect(filepath.Join(dir, "configured")).To(BeAnExistingFile())
+	})
+
+	context("failure cases", func() {
+		context("when the configure binary fails", func() {
+			it("returns an error", func() {
+				path := filepath.Join(dir, "configure")
+				Expect(os.WriteFile(path, []byte("#!/bin/sh\nexit 1\n"), 0755)).To(Succeed())
+
+				err := internal.Configure(path)
+				Expect(err).To(MatchError(ContainSubstring("failed to run")))
+				Expect(err).To(MatchError(ContainSubstring("exit status 1")))
+			})
+		})
+	})
+}
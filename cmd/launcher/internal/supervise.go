@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// Supervise runs the command in args and relays the signals received on
+// signals to it until it exits, returning its exit code, or 128 plus the
+// number of the signal that killed it. signals must receive SIGCHLD.
+//
+// SIGTERM and SIGINT become SIGQUIT, which makes nginx finish the requests in
+// flight before it exits. If it hasn't exited after drainTimeout, it is sent
+// SIGTERM to shut down right away. Other signals, such as SIGHUP, which makes
+// nginx reload its configuration, are forwarded as they are. As the launcher
+// runs as PID 1 of the container, it also reaps the orphaned processes that
+// are reparented to it.
+func Supervise(args []string, drainTimeout time.Duration, signals <-chan os.Signal) (int, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	err := cmd.Start()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start %s: %w", args[0], err)
+	}
+
+	var drain <-chan time.Time
+	for {
+		select {
+		case sig := <-signals:
+			switch sig {
+			case syscall.SIGCHLD:
+				if code, exited := reap(cmd.Process.Pid); exited {
+					return code, nil
+				}
+
+			case syscall.SIGTERM, syscall.SIGINT:
+				if drain != nil {
+					continue
+				}
+
+				log.Printf("Received %s, draining connections for up to %s", sig, drainTimeout)
+				err = cmd.Process.Signal(syscall.SIGQUIT)
+				if err != nil {
+					return 0, fmt.Errorf("failed to signal %s: %w", args[0], err)
+				}
+				drain = time.After(drainTimeout)
+
+			default:
+				err = cmd.Process.Signal(sig)
+				if err != nil {
+					return 0, fmt.Errorf("failed to signal %s: %w", args[0], err)
+				}
+			}
+
+		case <-drain:
+			log.Printf("Connections not drained within %s, shutting down", drainTimeout)
+			err = cmd.Process.Signal(syscall.SIGTERM)
+			if err != nil {
+				return 0, fmt.Errorf("failed to signal %s: %w", args[0], err)
+			}
+		}
+	}
+}
+
+// reap collects the exit status of every child that has exited, without
+// waiting for the others, and reports the exit code of the child with the
+// given pid once it is among them.
+func reap(pid int) (int, bool) {
+	for {
+		var status syscall.WaitStatus
+		reaped, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+		if err != nil || reaped <= 0 {
+			return 0, false
+		}
+
+		if reaped != pid {
+			continue
+		}
+
+		if status.Signaled() {
+			return 128 + int(status.Signal()), true
+		}
+
+		return status.ExitStatus(), true
+	}
+}
@@ -0,0 +1,117 @@
+package internal_test
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/paketo-buildpacks/nginx/cmd/launcher/internal"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestUnitLauncher(t *testing.T) {
+	suite := spec.New("cmd/launcher/internal", spec.Report(report.Terminal{}))
+	suite("Configure", testConfigure)
+	suite("Supervise", testSupervise)
+	suite.Run(t)
+}
+
+func testSupervise(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect     = NewWithT(t).Expect
+		Eventually = NewWithT(t).Eventually
+
+		signals chan os.Signal
+		ready   string
+	)
+
+	type result struct {
+		code int
+		err  error
+	}
+
+	supervise := func(script string, drainTimeout time.Duration) <-chan result {
+		results := make(chan result, 1)
+		go func() {
+			code, err := internal.Supervise([]string{"sh", "-c", script}, drainTimeout, signals)
+			results <- result{code, err}
+		}()
+
+		return results
+	}
+
+	it.Before(func() {
+		signals = make(chan os.Signal, 16)
+		signal.Notify(signals, syscall.SIGCHLD)
+
+		ready = filepath.Join(t.TempDir(), "ready")
+	})
+
+	it.After(func() {
+		signal.Stop(signals)
+	})
+
+	it("returns the exit code of the command", func() {
+		var r result
+		Eventually(supervise("exit 3", time.Second), "5s").Should(Receive(&r))
+		Expect(r.err).NotTo(HaveOccurred())
+		Expect(r.code).To(Equal(3))
+	})
+
+	context("when SIGTERM is received", func() {
+		it("sends SIGQUIT for a graceful shutdown", func() {
+			results := supervise(`trap 'exit 7' QUIT; touch `+ready+`; while true; do sleep 0.01; done`, time.Minute)
+			Eventually(ready, "5s").Should(BeAnExistingFile())
+
+			signals <- syscall.SIGTERM
+
+			var r result
+			Eventually(results, "5s").Should(Receive(&r))
+			Expect(r.err).NotTo(HaveOccurred())
+			Expect(r.code).To(Equal(7))
+		})
+
+		context("when the command doesn't exit within the drain timeout", func() {
+			it("sends SIGTERM and returns the exit code for the signal", func() {
+				results := supervise(`trap '' QUIT; touch `+ready+`; while true; do sleep 0.01; done`, 100*time.Millisecond)
+				Eventually(ready, "5s").Should(BeAnExistingFile())
+
+				signals <- syscall.SIGTERM
+
+				var r result
+				Eventually(results, "5s").Should(Receive(&r))
+				Expect(r.err).NotTo(HaveOccurred())
+				Expect(r.code).To(Equal(128 + int(syscall.SIGTERM)))
+			})
+		})
+	})
+
+	context("when SIGHUP is received", func() {
+		it("forwards it", func() {
+			results := supervise(`trap 'exit 9' HUP; touch `+ready+`; while true; do sleep 0.01; done`, time.Minute)
+			Eventually(ready, "5s").Should(BeAnExistingFile())
+
+			signals <- syscall.SIGHUP
+
+			var r result
+			Eventually(results, "5s").Should(Receive(&r))
+			Expect(r.err).NotTo(HaveOccurred())
+			Expect(r.code).To(Equal(9))
+		})
+	})
+
+	context("failure cases", func() {
+		context("when the command cannot be started", func() {
+			it("returns an error", func() {
+				_, err := internal.Supervise([]string{filepath.Join(t.TempDir(), "missing")}, time.Second, signals)
+				Expect(err).To(MatchError(ContainSubstring("failed to start")))
+			})
+		})
+	})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/paketo-buildpacks/nginx/cmd/launcher/internal"
+)
+
+func main() {
+	log.SetFlags(0)
+
+	args := os.Args[1:]
+	if len(args) > 1 && args[0] == "--configure" {
+		err := internal.Configure(args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		args = args[2:]
+	}
+
+	if len(args) < 1 {
+		log.Fatal("usage: launcher [--configure <binary>] <command> [<args>...]")
+	}
+
+	drainTimeout := 25 * time.Second
+	if value := os.Getenv("BPL_NGINX_DRAIN_TIMEOUT"); value != "" {
+		var err error
+		drainTimeout, err = time.ParseDuration(value)
+		if err != nil || drainTimeout < 0 {
+			log.Fatalf("invalid BPL_NGINX_DRAIN_TIMEOUT value %q: expected a duration such as '25s'", value)
+		}
+	}
+
+	// Signals are subscribed to before nginx starts, so that none is missed
+	signals := make(chan os.Signal, 16)
+	signal.Notify(signals, syscall.SIGCHLD, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGWINCH)
+
+	code, err := internal.Supervise(args, drainTimeout, signals)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	os.Exit(code)
+}
@@ -1,19 +1,18 @@
 package nginx
 
 import (
-	"errors"
 	"fmt"
-	"path/filepath"
+	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/Netflix/go-env"
-	"github.com/paketo-buildpacks/packit/v2/servicebindings"
 )
 
-//go:generate faux --interface BindingsResolver --output fakes/bindings_resolver.go
-type BindingsResolver interface {
-	ResolveOne(typ, provider, platformDir string) (servicebindings.Binding, error)
-}
+// timeRegexp matches the time syntax of nginx directives, e.g. 30s or 1m30s,
+// where a number without a unit is in seconds.
+var timeRegexp = regexp.MustCompile(`^([0-9]+(ms|[smhdwMy])?)+$`)
 
 type Configuration struct {
 	NGINXConfLocation        string `env:"BP_NGINX_CONF_LOCATION"`
@@ -26,11 +25,117 @@ type Configuration struct {
 	WebServerLocationPath    string `env:"BP_WEB_SERVER_LOCATION_PATH"`
 	WebServerIncludeFilePath string `env:"BP_WEB_SERVER_INCLUDE_FILE_PATH"`
 	NGINXStubStatusPort      string `env:"BP_NGINX_STUB_STATUS_PORT"`
+	NGINXMetricsExporter     bool   `env:"BP_NGINX_METRICS_EXPORTER"`
+	NGINXLintWarnings        string `env:"BP_NGINX_LINT_WARNINGS"`
+
+	NGINXModules StringList `env:"BP_NGINX_MODULES"`
+
+	WebServerProxyPass           ProxyRules `env:"BP_WEB_SERVER_PROXY_PASS"`
+	WebServerProxyConnectTimeout string     `env:"BP_WEB_SERVER_PROXY_CONNECT_TIMEOUT"`
+	WebServerProxyReadTimeout    string     `env:"BP_WEB_SERVER_PROXY_READ_TIMEOUT"`
+	WebServerProxySendTimeout    string     `env:"BP_WEB_SERVER_PROXY_SEND_TIMEOUT"`
+	WebServerTLSPort             string     `env:"BP_WEB_SERVER_TLS_PORT"`
+
+	WebServerErrorPage404 string `env:"BP_WEB_SERVER_ERROR_PAGE_404"`
+	WebServerErrorPage5xx string `env:"BP_WEB_SERVER_ERROR_PAGE_5XX"`
+
+	WebServerCleanURLs     bool   `env:"BP_WEB_SERVER_CLEAN_URLS"`
+	WebServerTrailingSlash string `env:"BP_WEB_SERVER_TRAILING_SLASH"`
+
+	WebServerPushStateExcludePaths      StringList `env:"BP_WEB_SERVER_PUSH_STATE_EXCLUDE_PATHS"`
+	WebServerPushStateExcludeExtensions StringList `env:"BP_WEB_SERVER_PUSH_STATE_EXCLUDE_EXTENSIONS"`
+
+	WebServerAccessLogFormat       string     `env:"BP_WEB_SERVER_ACCESS_LOG_FORMAT"`
+	WebServerAccessLogExcludePaths StringList `env:"BP_WEB_SERVER_ACCESS_LOG_EXCLUDE_PATHS"`
+
+	WebServerRuntimeEnvPrefix string `env:"BP_WEB_SERVER_RUNTIME_ENV_PREFIX"`
+	WebServerRuntimeEnvFile   string `env:"BP_WEB_SERVER_RUNTIME_ENV_FILE"`
+
+	WebServerSecurityHeaders         bool   `env:"BP_WEB_SERVER_SECURITY_HEADERS"`
+	WebServerStrictTransportSecurity string `env:"BP_WEB_SERVER_STRICT_TRANSPORT_SECURITY"`
+	WebServerContentTypeOptions      string `env:"BP_WEB_SERVER_X_CONTENT_TYPE_OPTIONS"`
+	WebServerFrameOptions            string `env:"BP_WEB_SERVER_X_FRAME_OPTIONS"`
+	WebServerReferrerPolicy          string `env:"BP_WEB_SERVER_REFERRER_POLICY"`
+	WebServerPermissionsPolicy       string `env:"BP_WEB_SERVER_PERMISSIONS_POLICY"`
+	WebServerContentSecurityPolicy   string `env:"BP_WEB_SERVER_CONTENT_SECURITY_POLICY"`
+
+	WebServerCacheControl           bool   `env:"BP_WEB_SERVER_CACHE_CONTROL"`
+	WebServerImmutableAssetsPattern string `env:"BP_WEB_SERVER_IMMUTABLE_ASSETS_PATTERN"`
+	WebServerImmutableAssetsMaxAge  string `env:"BP_WEB_SERVER_IMMUTABLE_ASSETS_MAX_AGE"`
+	WebServerHTMLPattern            string `env:"BP_WEB_SERVER_HTML_PATTERN"`
+	WebServerHTMLMaxAge             string `env:"BP_WEB_SERVER_HTML_MAX_AGE"`
+
+	WebServerPrecompress       bool `env:"BP_WEB_SERVER_PRECOMPRESS"`
+	WebServerPrecompressBrotli bool `env:"BP_WEB_SERVER_PRECOMPRESS_BROTLI"`
+
+	Redirects []RedirectRule
+	Headers   []HeaderRule
+}
+
+// ProxyRule maps a location path prefix onto the upstream URL that requests
+// under that prefix are proxied to.
+type ProxyRule struct {
+	Path     string
+	Upstream string
+}
+
+// ProxyRules is parsed from a comma-separated list of "<prefix>=<upstream>"
+// pairs, e.g. "/api/=http://backend:8080,/auth/=http://auth:9000/".
+type ProxyRules []ProxyRule
+
+func (r *ProxyRules) UnmarshalEnvironmentValue(data string) error {
+	var rules ProxyRules
+	for _, pair := range strings.Split(data, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		path, upstream, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid BP_WEB_SERVER_PROXY_PASS entry %q: expected format '<path>=<upstream>'", pair)
+		}
+
+		path, upstream = strings.TrimSpace(path), strings.TrimSpace(upstream)
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("invalid BP_WEB_SERVER_PROXY_PASS entry %q: path must start with '/'", pair)
+		}
+
+		// The path is written unquoted into the location directive
+		if strings.ContainsAny(path, " \t;{}\"'\\$") {
+			return fmt.Errorf("invalid BP_WEB_SERVER_PROXY_PASS entry %q: path contains unsupported characters", pair)
+		}
 
-	BasicAuthFile string
+		u, err := url.Parse(upstream)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid BP_WEB_SERVER_PROXY_PASS entry %q: upstream must be an absolute http(s) URL", pair)
+		}
+
+		rules = append(rules, ProxyRule{Path: path, Upstream: upstream})
+	}
+
+	*r = rules
+	return nil
 }
 
-func LoadConfiguration(environ []string, bindingsResolver BindingsResolver, platformPath string) (Configuration, error) {
+// StringList is parsed from a comma-separated list, ignoring whitespace around
+// and empty entries.
+type StringList []string
+
+func (l *StringList) UnmarshalEnvironmentValue(data string) error {
+	var list StringList
+	for _, item := range strings.Split(data, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+
+	*l = list
+	return nil
+}
+
+func LoadConfiguration(environ []string) (Configuration, error) {
 	es, err := env.EnvironToEnvSet(environ)
 	if err != nil {
 		return Configuration{}, fmt.Errorf("failed to parse environment variables: %w", err)
@@ -39,6 +144,8 @@ func LoadConfiguration(environ []string, bindingsResolver BindingsResolver, plat
 	configuration := Configuration{
 		NGINXConfLocation: "./nginx.conf",
 		WebServerRoot:     "./public",
+
+		WebServerRuntimeEnvFile: "env.js",
 	}
 
 	err = env.Unmarshal(es, &configuration)
@@ -46,18 +153,31 @@ func LoadConfiguration(environ []string, bindingsResolver BindingsResolver, plat
 		return Configuration{}, err
 	}
 
-	if configuration.WebServer == "nginx" {
-		binding, err := bindingsResolver.ResolveOne("htpasswd", "", platformPath)
-		if err != nil && !strings.Contains(err.Error(), "expected exactly 1") {
-			return Configuration{}, err
+	for _, timeout := range []struct{ name, value string }{
+		{"BP_WEB_SERVER_PROXY_CONNECT_TIMEOUT", configuration.WebServerProxyConnectTimeout},
+		{"BP_WEB_SERVER_PROXY_READ_TIMEOUT", configuration.WebServerProxyReadTimeout},
+		{"BP_WEB_SERVER_PROXY_SEND_TIMEOUT", configuration.WebServerProxySendTimeout},
+	} {
+		if timeout.value != "" && !timeRegexp.MatchString(timeout.value) {
+			return Configuration{}, fmt.Errorf("invalid %s value %q: expected an nginx time such as '30s'", timeout.name, timeout.value)
 		}
+	}
 
-		if err == nil {
-			if _, ok := binding.Entries[".htpasswd"]; !ok {
-				return Configuration{}, errors.New("binding of type 'htpasswd' does not contain required entry '.htpasswd'")
-			}
+	if port := configuration.WebServerTLSPort; port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return Configuration{}, fmt.Errorf("invalid BP_WEB_SERVER_TLS_PORT value %q: expected a port number between 1 and 65535", port)
+		}
+	}
 
-			configuration.BasicAuthFile = filepath.Join(binding.Path, ".htpasswd")
+	for _, maxAge := range []struct{ name, value string }{
+		{"BP_WEB_SERVER_IMMUTABLE_ASSETS_MAX_AGE", configuration.WebServerImmutableAssetsMaxAge},
+		{"BP_WEB_SERVER_HTML_MAX_AGE", configuration.WebServerHTMLMaxAge},
+	} {
+		switch {
+		case maxAge.value == "", maxAge.value == "epoch", maxAge.value == "max", maxAge.value == "off":
+		case timeRegexp.MatchString(maxAge.value):
+		default:
+			return Configuration{}, fmt.Errorf("invalid %s value %q: expected an nginx time such as '1y', 'epoch', 'max' or 'off'", maxAge.name, maxAge.value)
 		}
 	}
 
@@ -1,12 +1,9 @@
 package nginx_test
 
 import (
-	"errors"
 	"testing"
 
 	"github.com/paketo-buildpacks/nginx"
-	"github.com/paketo-buildpacks/nginx/fakes"
-	"github.com/paketo-buildpacks/packit/v2/servicebindings"
 	"github.com/sclevine/spec"
 
 	. "github.com/onsi/gomega"
@@ -16,20 +13,6 @@ func testConfiguration(t *testing.T, context spec.G, it spec.S) {
 	var Expect = NewWithT(t).Expect
 
 	context("LoadConfiguration", func() {
-		var bindingsResolver *fakes.BindingsResolver
-
-		it.Before(func() {
-			bindingsResolver = &fakes.BindingsResolver{}
-			bindingsResolver.ResolveOneCall.Returns.Binding = servicebindings.Binding{
-				Name: "first",
-				Type: "htpasswd",
-				Path: "/path/to/binding/",
-				Entries: map[string]*servicebindings.Entry{
-					".htpasswd": servicebindings.NewEntry("/path/to/binding/.htpasswd"),
-				},
-			}
-		})
-
 		it("loads the buildpack configuration", func() {
 			config, err := nginx.LoadConfiguration([]string{
 				"BP_NGINX_CONF_LOCATION=some-conf-location",
@@ -38,11 +21,37 @@ func testConfiguration(t *testing.T, context spec.G, it spec.S) {
 				"BP_WEB_SERVER=some-web-server",
 				"BP_WEB_SERVER_FORCE_HTTPS=true",
 				"BP_WEB_SERVER_ENABLE_PUSH_STATE=true",
+				"BP_WEB_SERVER_PUSH_STATE_EXCLUDE_PATHS=/api/, /static/,",
+				"BP_WEB_SERVER_PUSH_STATE_EXCLUDE_EXTENSIONS=js,css",
+				"BP_WEB_SERVER_RUNTIME_ENV_PREFIX=PUBLIC_",
+				"BP_WEB_SERVER_RUNTIME_ENV_FILE=config.json",
 				"BP_WEB_SERVER_ROOT=some-root",
 				"BP_WEB_SERVER_LOCATION_PATH=some-location-path",
 				"BP_WEB_SERVER_INCLUDE_FILE_PATH=some-location-include",
 				"BP_NGINX_STUB_STATUS_PORT=8083",
-			}, bindingsResolver, "some-platform-path")
+				"BP_NGINX_METRICS_EXPORTER=true",
+				"BP_WEB_SERVER_ACCESS_LOG_FORMAT=json",
+				"BP_WEB_SERVER_ACCESS_LOG_EXCLUDE_PATHS=/healthz, /ready",
+				"BP_NGINX_LINT_WARNINGS=error",
+				"BP_NGINX_MODULES=headers-more, njs",
+				"BP_WEB_SERVER_PROXY_PASS=/api/=http://backend:8080, /auth/=https://auth:9000/v1/",
+				"BP_WEB_SERVER_PROXY_CONNECT_TIMEOUT=5s",
+				"BP_WEB_SERVER_PROXY_READ_TIMEOUT=30s",
+				"BP_WEB_SERVER_PROXY_SEND_TIMEOUT=15s",
+				"BP_WEB_SERVER_TLS_PORT=9443",
+				"BP_WEB_SERVER_SECURITY_HEADERS=true",
+				"BP_WEB_SERVER_STRICT_TRANSPORT_SECURITY=max-age=600",
+				"BP_WEB_SERVER_X_CONTENT_TYPE_OPTIONS=nosniff",
+				"BP_WEB_SERVER_X_FRAME_OPTIONS=SAMEORIGIN",
+				"BP_WEB_SERVER_REFERRER_POLICY=no-referrer",
+				"BP_WEB_SERVER_PERMISSIONS_POLICY=camera=()",
+				"BP_WEB_SERVER_CONTENT_SECURITY_POLICY=default-src 'self'",
+				"BP_WEB_SERVER_CACHE_CONTROL=true",
+				"BP_WEB_SERVER_IMMUTABLE_ASSETS_PATTERN=some-assets-pattern",
+				"BP_WEB_SERVER_IMMUTABLE_ASSETS_MAX_AGE=30d",
+				"BP_WEB_SERVER_HTML_PATTERN=some-html-pattern",
+				"BP_WEB_SERVER_HTML_MAX_AGE=5m",
+			})
 			Expect(err).NotTo(HaveOccurred())
 			Expect(config).To(Equal(nginx.Configuration{
 				NGINXConfLocation:        "some-conf-location",
@@ -55,12 +64,45 @@ func testConfiguration(t *testing.T, context spec.G, it spec.S) {
 				WebServerLocationPath:    "some-location-path",
 				WebServerIncludeFilePath: "some-location-include",
 				NGINXStubStatusPort:      "8083",
+				NGINXMetricsExporter:     true,
+				NGINXLintWarnings:        "error",
+				NGINXModules:             nginx.StringList{"headers-more", "njs"},
+
+				WebServerAccessLogFormat:       "json",
+				WebServerAccessLogExcludePaths: nginx.StringList{"/healthz", "/ready"},
+
+				WebServerProxyPass: nginx.ProxyRules{
+					{Path: "/api/", Upstream: "http://backend:8080"},
+					{Path: "/auth/", Upstream: "https://auth:9000/v1/"},
+				},
+				WebServerProxyConnectTimeout:     "5s",
+				WebServerProxyReadTimeout:        "30s",
+				WebServerProxySendTimeout:        "15s",
+				WebServerTLSPort:                 "9443",
+				WebServerSecurityHeaders:         true,
+				WebServerStrictTransportSecurity: "max-age=600",
+				WebServerContentTypeOptions:      "nosniff",
+				WebServerFrameOptions:            "SAMEORIGIN",
+				WebServerReferrerPolicy:          "no-referrer",
+				WebServerPermissionsPolicy:       "camera=()",
+				WebServerContentSecurityPolicy:   "default-src 'self'",
+				WebServerCacheControl:            true,
+				WebServerImmutableAssetsPattern:  "some-assets-pattern",
+				WebServerImmutableAssetsMaxAge:   "30d",
+				WebServerHTMLPattern:             "some-html-pattern",
+				WebServerHTMLMaxAge:              "5m",
+
+				WebServerPushStateExcludePaths:      nginx.StringList{"/api/", "/static/"},
+				WebServerPushStateExcludeExtensions: nginx.StringList{"js", "css"},
+
+				WebServerRuntimeEnvPrefix: "PUBLIC_",
+				WebServerRuntimeEnvFile:   "config.json",
 			}))
 		})
 
 		context("when no BP_NGINX_CONF_LOCATION is set", func() {
 			it("assigns a default", func() {
-				config, err := nginx.LoadConfiguration(nil, bindingsResolver, "some-platform-path")
+				config, err := nginx.LoadConfiguration(nil)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(config.NGINXConfLocation).To(Equal("./nginx.conf"))
 			})
@@ -68,31 +110,17 @@ func testConfiguration(t *testing.T, context spec.G, it spec.S) {
 
 		context("when no BP_WEB_SERVER_ROOT is set", func() {
 			it("assigns a default", func() {
-				config, err := nginx.LoadConfiguration(nil, bindingsResolver, "some-platform-path")
+				config, err := nginx.LoadConfiguration(nil)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(config.WebServerRoot).To(Equal("./public"))
 			})
 		})
 
-		context("when BP_WEB_SERVER=nginx", func() {
-			context("when a .htpasswd service binding is provided", func() {
-				it("loads the binding path", func() {
-					config, err := nginx.LoadConfiguration([]string{"BP_WEB_SERVER=nginx"}, bindingsResolver, "some-platform-path")
-					Expect(err).NotTo(HaveOccurred())
-					Expect(config.BasicAuthFile).To(Equal("/path/to/binding/.htpasswd"))
-				})
-			})
-
-			context("when a .htpasswd service binding is NOT provided", func() {
-				it.Before(func() {
-					bindingsResolver.ResolveOneCall.Returns.Error = errors.New("expected exactly 1")
-				})
-
-				it("does not load the binding path", func() {
-					config, err := nginx.LoadConfiguration([]string{"BP_WEB_SERVER=nginx"}, bindingsResolver, "some-platform-path")
-					Expect(err).NotTo(HaveOccurred())
-					Expect(config.BasicAuthFile).To(Equal(""))
-				})
+		context("when no BP_WEB_SERVER_RUNTIME_ENV_FILE is set", func() {
+			it("assigns a default", func() {
+				config, err := nginx.LoadConfiguration(nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(config.WebServerRuntimeEnvFile).To(Equal("env.js"))
 			})
 		})
 
@@ -101,37 +129,57 @@ func testConfiguration(t *testing.T, context spec.G, it spec.S) {
 				it("returns an error", func() {
 					_, err := nginx.LoadConfiguration([]string{
 						"this is not a parseable environment variable",
-					}, bindingsResolver, "some-platform-path")
+					})
 					Expect(err).To(MatchError("failed to parse environment variables: items in environ must have format key=value"))
 				})
 			})
 
-			context("when resolving the .htpasswd service binding fails", func() {
-				it.Before(func() {
-					bindingsResolver.ResolveOneCall.Returns.Error = errors.New("some bindings error")
+			context("when BP_WEB_SERVER_PROXY_PASS is malformed", func() {
+				it("returns an error", func() {
+					_, err := nginx.LoadConfiguration([]string{"BP_WEB_SERVER_PROXY_PASS=/api/"})
+					Expect(err).To(MatchError(`invalid BP_WEB_SERVER_PROXY_PASS entry "/api/": expected format '<path>=<upstream>'`))
+
+					_, err = nginx.LoadConfiguration([]string{"BP_WEB_SERVER_PROXY_PASS=api=http://backend"})
+					Expect(err).To(MatchError(`invalid BP_WEB_SERVER_PROXY_PASS entry "api=http://backend": path must start with '/'`))
+
+					_, err = nginx.LoadConfiguration([]string{"BP_WEB_SERVER_PROXY_PASS=/api;return 200;=http://backend"})
+					Expect(err).To(MatchError(`invalid BP_WEB_SERVER_PROXY_PASS entry "/api;return 200;=http://backend": path contains unsupported characters`))
+
+					_, err = nginx.LoadConfiguration([]string{"BP_WEB_SERVER_PROXY_PASS=/api/{x}=http://backend"})
+					Expect(err).To(MatchError(`invalid BP_WEB_SERVER_PROXY_PASS entry "/api/{x}=http://backend": path contains unsupported characters`))
+
+					_, err = nginx.LoadConfiguration([]string{"BP_WEB_SERVER_PROXY_PASS=/api/=backend:8080"})
+					Expect(err).To(MatchError(`invalid BP_WEB_SERVER_PROXY_PASS entry "/api/=backend:8080": upstream must be an absolute http(s) URL`))
 				})
+			})
 
+			context("when a proxy timeout is not an nginx time", func() {
 				it("returns an error", func() {
-					_, err := nginx.LoadConfiguration([]string{"BP_WEB_SERVER=nginx"}, bindingsResolver, "some-platform-path")
-					Expect(err).To(MatchError(ContainSubstring("some bindings error")))
+					_, err := nginx.LoadConfiguration([]string{"BP_WEB_SERVER_PROXY_READ_TIMEOUT=30s; evil_directive"})
+					Expect(err).To(MatchError(`invalid BP_WEB_SERVER_PROXY_READ_TIMEOUT value "30s; evil_directive": expected an nginx time such as '30s'`))
+
+					_, err = nginx.LoadConfiguration([]string{"BP_WEB_SERVER_PROXY_SEND_TIMEOUT=soon"})
+					Expect(err).To(MatchError(`invalid BP_WEB_SERVER_PROXY_SEND_TIMEOUT value "soon": expected an nginx time such as '30s'`))
 				})
 			})
 
-			context("when the .htpasswd service binding is malformed", func() {
-				it.Before(func() {
-					bindingsResolver.ResolveOneCall.Returns.Binding = servicebindings.Binding{
-						Name: "first",
-						Type: "htpasswd",
-						Path: "/path/to/binding/",
-						Entries: map[string]*servicebindings.Entry{
-							"some-irrelevant-file": servicebindings.NewEntry("some-irrelevant-path"),
-						},
-					}
+			context("when the TLS port is not a port number", func() {
+				it("returns an error", func() {
+					_, err := nginx.LoadConfiguration([]string{"BP_WEB_SERVER_TLS_PORT=8443 ssl; evil_directive"})
+					Expect(err).To(MatchError(`invalid BP_WEB_SERVER_TLS_PORT value "8443 ssl; evil_directive": expected a port number between 1 and 65535`))
+
+					_, err = nginx.LoadConfiguration([]string{"BP_WEB_SERVER_TLS_PORT=70000"})
+					Expect(err).To(MatchError(`invalid BP_WEB_SERVER_TLS_PORT value "70000": expected a port number between 1 and 65535`))
 				})
+			})
 
+			context("when a max-age is not an nginx time", func() {
 				it("returns an error", func() {
-					_, err := nginx.LoadConfiguration([]string{"BP_WEB_SERVER=nginx"}, bindingsResolver, "some-platform-path")
-					Expect(err).To(MatchError("binding of type 'htpasswd' does not contain required entry '.htpasswd'"))
+					_, err := nginx.LoadConfiguration([]string{"BP_WEB_SERVER_IMMUTABLE_ASSETS_MAX_AGE=1 year"})
+					Expect(err).To(MatchError(`invalid BP_WEB_SERVER_IMMUTABLE_ASSETS_MAX_AGE value "1 year": expected an nginx time such as '1y', 'epoch', 'max' or 'off'`))
+
+					_, err = nginx.LoadConfiguration([]string{"BP_WEB_SERVER_HTML_MAX_AGE=never"})
+					Expect(err).To(MatchError(`invalid BP_WEB_SERVER_HTML_MAX_AGE value "never": expected an nginx time such as '1y', 'epoch', 'max' or 'off'`))
 				})
 			})
 		})
@@ -1,10 +1,25 @@
 package nginx
 
 const (
-	NGINX = "nginx"
+	NGINX               = "nginx"
+	PrecompressedAssets = "precompressed-assets"
+	Modules             = "modules"
+	MetricsExporter     = "metrics-exporter"
+	Launcher            = "launcher"
 
 	DepKey             = "dependency-sha"
 	ConfigureBinKey    = "configure-bin-sha"
+	ExporterBinKey     = "exporter-bin-sha"
+	LauncherBinKey     = "launcher-bin-sha"
+	ModulesKey         = "modules"
 	ConfFile           = "nginx.conf"
 	BuildpackYMLSource = "buildpack.yml"
+
+	// ModuleDependencyPrefix is prepended to the names in BP_NGINX_MODULES to
+	// find the module dependencies in buildpack.toml.
+	ModuleDependencyPrefix = "nginx-module-"
+
+	// RuntimeDir is where the configure exec.d binary renders the templates in
+	// nginx.conf at launch, and the prefix nginx runs with.
+	RuntimeDir = "/tmp/nginx"
 )
@@ -3,10 +3,15 @@ package nginx
 import (
 	"bytes"
 	_ "embed"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"text/template"
 
 	"github.com/paketo-buildpacks/packit/v2/scribe"
@@ -15,10 +20,77 @@ import (
 //go:embed assets/default.conf
 var DefaultConfigTemplate string
 
+// DefaultImmutableAssetsPattern matches files whose names carry a content hash
+// of at least 8 hex characters, as emitted by bundlers like webpack, e.g.
+// app.3f9a1c2b.js or chunk-5d41402abc4b2a76.css.
+const DefaultImmutableAssetsPattern = `[.-][0-9a-f]{8,}\.(css|js|mjs|map|json|woff2?|ttf|otf|eot|png|jpe?g|gif|svg|webp|avif|ico)$`
+
+var extensionRegexp = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
 type DefaultConfigGenerator struct {
 	logs scribe.Emitter
 }
 
+// ResponseHeader is a header added to every response from a location with
+// add_header ... always.
+type ResponseHeader struct {
+	Name  string
+	Value string
+}
+
+// defaultConfigData holds the values computed from the configuration that
+// the default config template renders alongside it.
+type defaultConfigData struct {
+	Configuration
+
+	SecurityHeaders []ResponseHeader
+	PathHeaders     []pathHeader
+	RedirectBlocks  []redirectBlock
+	ErrorPages      []errorPage
+	ErrorPageURIs   []string
+
+	PushStateExcludePattern  string
+	RedirectProxyPattern     string
+	RuntimeEnvURI            string
+	RuntimeEnvPath           string
+	AccessLogExcludePatterns []string
+
+	// CacheControlOverride is set when _headers sets Cache-Control, which
+	// then takes precedence over the caching rules of the locations
+	CacheControlOverride bool
+}
+
+// errorPage is a custom page, given as a URI under the server root, that is
+// served for responses with one of the Codes.
+type errorPage struct {
+	Codes string
+	URI   string
+}
+
+// pathHeader is a header from _headers whose value is selected by request
+// path with a map, so that rules for overlapping paths combine instead of
+// competing for a location. Default holds the security header of the same
+// name, if any, which applies to paths that no rule matches.
+type pathHeader struct {
+	Name     string
+	Variable string
+	Default  string
+	Rules    []pathHeaderRule
+}
+
+type pathHeaderRule struct {
+	Regex string
+	Value string
+}
+
+// redirectBlock is a run of consecutive _redirects rules that either are all
+// forced or all apply only when the requested file does not exist. Keeping
+// the runs in file order preserves the first-match-wins semantics of the file.
+type redirectBlock struct {
+	Force bool
+	Rules []RedirectRule
+}
+
 func NewDefaultConfigGenerator(logs scribe.Emitter) DefaultConfigGenerator {
 	return DefaultConfigGenerator{logs: logs}
 }
@@ -39,30 +111,233 @@ func (g DefaultConfigGenerator) Generate(config Configuration) error {
 
 	g.logs.Subprocess("Setting server location path to '%s'", config.WebServerLocationPath)
 
+	var pushStateExcludePattern string
 	if config.WebServerEnablePushState {
 		g.logs.Subprocess("Enabling push state routing")
+
+		for _, prefix := range config.WebServerPushStateExcludePaths {
+			if prefix == config.WebServerLocationPath || !strings.HasPrefix(prefix, config.WebServerLocationPath) || strings.ContainsAny(prefix, " \t;{}\"'") {
+				return fmt.Errorf("push state exclusion path '%s' (BP_WEB_SERVER_PUSH_STATE_EXCLUDE_PATHS) must be a path under the server location path '%s'", prefix, config.WebServerLocationPath)
+			}
+
+			// Both would be locations for the same prefix, which nginx rejects
+			for _, rule := range config.WebServerProxyPass {
+				if rule.Path == prefix {
+					return fmt.Errorf("push state exclusion path '%s' (BP_WEB_SERVER_PUSH_STATE_EXCLUDE_PATHS) is already proxied (BP_WEB_SERVER_PROXY_PASS)", prefix)
+				}
+			}
+
+			g.logs.Action("Excluding paths under '%s'", prefix)
+		}
+
+		var extensions []string
+		for _, extension := range config.WebServerPushStateExcludeExtensions {
+			extension = strings.TrimPrefix(extension, ".")
+			if !extensionRegexp.MatchString(extension) {
+				return fmt.Errorf("push state exclusion extension '%s' (BP_WEB_SERVER_PUSH_STATE_EXCLUDE_EXTENSIONS) is invalid", extension)
+			}
+
+			extensions = append(extensions, extension)
+		}
+
+		if len(extensions) > 0 {
+			pushStateExcludePattern = fmt.Sprintf(`\.(%s)$`, strings.Join(extensions, "|"))
+			g.logs.Action("Excluding files with extension %s", strings.Join(extensions, ", "))
+		}
+	}
+
+	if config.WebServerCleanURLs {
+		if config.WebServerEnablePushState {
+			return errors.New("clean URLs (BP_WEB_SERVER_CLEAN_URLS) cannot be combined with push state routing (BP_WEB_SERVER_ENABLE_PUSH_STATE)")
+		}
+
+		g.logs.Subprocess("Enabling clean URLs")
+	}
+
+	switch config.WebServerTrailingSlash {
+	case "":
+	case "add":
+		g.logs.Subprocess("Redirecting paths without a trailing slash to add one")
+	case "strip":
+		// Without try_files, nginx redirects requests for directories to the
+		// path with a trailing slash, which would redirect back and forth
+		if !config.WebServerCleanURLs {
+			return errors.New("stripping trailing slashes (BP_WEB_SERVER_TRAILING_SLASH) requires clean URLs (BP_WEB_SERVER_CLEAN_URLS)")
+		}
+
+		g.logs.Subprocess("Redirecting paths with a trailing slash to strip it")
+	default:
+		return fmt.Errorf("trailing slash mode '%s' (BP_WEB_SERVER_TRAILING_SLASH) is invalid, must be one of 'add' or 'strip'", config.WebServerTrailingSlash)
+	}
+
+	switch config.WebServerAccessLogFormat {
+	case "":
+		config.WebServerAccessLogFormat = "combined"
+	case "combined", "json":
+		g.logs.Subprocess("Writing access logs in the '%s' format", config.WebServerAccessLogFormat)
+	case "off":
+		g.logs.Subprocess("Disabling access logs")
+	default:
+		return fmt.Errorf("access log format '%s' (BP_WEB_SERVER_ACCESS_LOG_FORMAT) is invalid, must be one of 'combined', 'json' or 'off'", config.WebServerAccessLogFormat)
+	}
+
+	// Excluded paths match as prefixes of whole path segments, so that
+	// /healthz excludes /healthz/live but not /healthzone
+	var accessLogExcludePatterns []string
+	for _, prefix := range config.WebServerAccessLogExcludePaths {
+		if !strings.HasPrefix(prefix, "/") || strings.ContainsAny(prefix, " \t;{}\"'\\") {
+			return fmt.Errorf("access log exclusion path '%s' (BP_WEB_SERVER_ACCESS_LOG_EXCLUDE_PATHS) must be a path starting with '/'", prefix)
+		}
+
+		accessLogExcludePatterns = append(accessLogExcludePatterns, fmt.Sprintf("^%s(/|$)", regexp.QuoteMeta(strings.TrimSuffix(prefix, "/"))))
+		g.logs.Subprocess("Excluding paths under '%s' from the access log", prefix)
 	}
 
 	if config.WebServerForceHTTPS {
 		g.logs.Subprocess("Setting server to redirect HTTP requests to HTTPS")
 	}
 
-	if config.BasicAuthFile != "" {
-		g.logs.Subprocess("Enabling basic authentication with .htpasswd credentials")
+	// TLS is enabled at launch, if a 'tls' binding is provided then
+	if config.WebServerTLSPort == "" {
+		config.WebServerTLSPort = "8443"
+	}
+
+	if config.WebServerCacheControl {
+		if config.WebServerImmutableAssetsPattern == "" {
+			config.WebServerImmutableAssetsPattern = DefaultImmutableAssetsPattern
+		}
+
+		if config.WebServerImmutableAssetsMaxAge == "" {
+			config.WebServerImmutableAssetsMaxAge = "1y"
+		}
+
+		if config.WebServerHTMLPattern == "" {
+			config.WebServerHTMLPattern = `\.html?$`
+		}
+
+		if config.WebServerHTMLMaxAge == "" {
+			config.WebServerHTMLMaxAge = "epoch"
+		}
+
+		for _, pattern := range []string{config.WebServerImmutableAssetsPattern, config.WebServerHTMLPattern} {
+			if strings.Contains(pattern, `"`) {
+				return fmt.Errorf("cache control pattern '%s' must not contain '\"'", pattern)
+			}
+		}
+
+		g.logs.Subprocess("Caching assets matching '%s' for %s", config.WebServerImmutableAssetsPattern, config.WebServerImmutableAssetsMaxAge)
+		g.logs.Subprocess("Setting expiry of HTML matching '%s' to %s", config.WebServerHTMLPattern, config.WebServerHTMLMaxAge)
+
+		// The patterns are rendered as templates again at launch
+		config.WebServerImmutableAssetsPattern = escapeTemplate(config.WebServerImmutableAssetsPattern)
+		config.WebServerHTMLPattern = escapeTemplate(config.WebServerHTMLPattern)
 	}
 
 	if config.NGINXStubStatusPort != "" {
 		g.logs.Subprocess("Enabling basic status information with stub_status module")
+		if config.NGINXMetricsExporter {
+			g.logs.Subprocess("Binding stub_status to localhost for the metrics exporter")
+		}
 	}
 
 	if config.WebServerIncludeFilePath != "" {
 		g.logs.Subprocess("Enabling including custom config")
 	}
 
+	var redirectProxyPattern string
+	if len(config.WebServerProxyPass) > 0 {
+		if config.WebServerProxyConnectTimeout == "" {
+			config.WebServerProxyConnectTimeout = "10s"
+		}
+
+		if config.WebServerProxyReadTimeout == "" {
+			config.WebServerProxyReadTimeout = "60s"
+		}
+
+		if config.WebServerProxySendTimeout == "" {
+			config.WebServerProxySendTimeout = "60s"
+		}
+
+		var proxyPaths []string
+		for _, rule := range config.WebServerProxyPass {
+			if rule.Path == config.WebServerLocationPath {
+				return fmt.Errorf("proxy path '%s' (BP_WEB_SERVER_PROXY_PASS) conflicts with server location path", rule.Path)
+			}
+
+			proxyPaths = append(proxyPaths, regexp.QuoteMeta(rule.Path))
+			g.logs.Subprocess("Proxying requests under '%s' to '%s'", rule.Path, rule.Upstream)
+		}
+
+		redirectProxyPattern = fmt.Sprintf("^(?:%s)", strings.Join(proxyPaths, "|"))
+	}
+
+	if len(config.Redirects) > 0 {
+		g.logs.Subprocess("Adding %d rule(s) from %s", len(config.Redirects), RedirectsFile)
+	}
+
+	var (
+		errorPages    []errorPage
+		errorPageURIs []string
+	)
+	for _, page := range []struct{ codes, description, path string }{
+		{"404", "404", config.WebServerErrorPage404},
+		{"500 502 503 504", "5xx", config.WebServerErrorPage5xx},
+	} {
+		if page.path == "" {
+			continue
+		}
+
+		uri := path.Clean("/" + filepath.ToSlash(page.path))
+		errorPages = append(errorPages, errorPage{Codes: page.codes, URI: uri})
+		if !slices.Contains(errorPageURIs, uri) {
+			errorPageURIs = append(errorPageURIs, uri)
+		}
+
+		g.logs.Subprocess("Serving '%s' for %s responses", uri, page.description)
+	}
+
+	var runtimeEnvURI, runtimeEnvFile string
+	if config.WebServerRuntimeEnvPrefix != "" {
+		runtimeEnvURI = path.Clean("/" + filepath.ToSlash(config.WebServerRuntimeEnvFile))
+		runtimeEnvFile = runtimeEnvPath(config)
+		g.logs.Subprocess("Writing environment variables prefixed with '%s' to '%s' at launch", config.WebServerRuntimeEnvPrefix, runtimeEnvURI)
+	}
+
+	if len(config.Headers) > 0 {
+		g.logs.Subprocess("Adding %d rule(s) from %s", len(config.Headers), HeadersFile)
+	}
+
+	data := defaultConfigData{
+		Configuration:   config,
+		SecurityHeaders: securityHeaders(config),
+		RedirectBlocks:  redirectBlocks(config.Redirects),
+		ErrorPages:      errorPages,
+		ErrorPageURIs:   errorPageURIs,
+
+		PushStateExcludePattern:  pushStateExcludePattern,
+		RedirectProxyPattern:     redirectProxyPattern,
+		RuntimeEnvURI:            runtimeEnvURI,
+		RuntimeEnvPath:           runtimeEnvFile,
+		AccessLogExcludePatterns: accessLogExcludePatterns,
+	}
+	data.PathHeaders, data.SecurityHeaders = pathHeaders(config.Headers, data.SecurityHeaders)
+	for _, header := range data.PathHeaders {
+		if strings.EqualFold(header.Name, "Cache-Control") {
+			data.CacheControlOverride = true
+		}
+	}
+
+	if len(data.SecurityHeaders) > 0 {
+		g.logs.Subprocess("Adding security response headers")
+		for _, header := range data.SecurityHeaders {
+			g.logs.Action("%s: %s", header.Name, header.Value)
+		}
+	}
+
 	g.logs.Break()
 
 	var b bytes.Buffer
-	err := t.Execute(&b, config)
+	err := t.Execute(&b, data)
 	if err != nil {
 		// not tested
 		return err
@@ -85,3 +360,97 @@ func (g DefaultConfigGenerator) Generate(config Configuration) error {
 	}
 	return nil
 }
+
+// securityHeaders returns the security response headers to emit. Enabling
+// BP_WEB_SERVER_SECURITY_HEADERS provides defaults for every header except
+// Content-Security-Policy, which is application specific. A header that is set
+// explicitly is always emitted, unless its value is "off".
+func securityHeaders(config Configuration) []ResponseHeader {
+	headers := []struct {
+		name, value, preset string
+	}{
+		{"Strict-Transport-Security", config.WebServerStrictTransportSecurity, "max-age=31536000; includeSubDomains"},
+		{"X-Content-Type-Options", config.WebServerContentTypeOptions, "nosniff"},
+		{"X-Frame-Options", config.WebServerFrameOptions, "DENY"},
+		{"Referrer-Policy", config.WebServerReferrerPolicy, "strict-origin-when-cross-origin"},
+		{"Permissions-Policy", config.WebServerPermissionsPolicy, "camera=(), geolocation=(), microphone=()"},
+		{"Content-Security-Policy", config.WebServerContentSecurityPolicy, ""},
+	}
+
+	var result []ResponseHeader
+	for _, header := range headers {
+		value := header.value
+		if value == "" && config.WebServerSecurityHeaders {
+			value = header.preset
+		}
+
+		if value == "" || value == "off" {
+			continue
+		}
+
+		result = append(result, ResponseHeader{
+			Name:  header.name,
+			Value: escapeTemplate(strings.ReplaceAll(value, `"`, `\"`)),
+		})
+	}
+
+	return result
+}
+
+func redirectBlocks(rules []RedirectRule) []redirectBlock {
+	var blocks []redirectBlock
+	for _, rule := range rules {
+		if len(blocks) == 0 || blocks[len(blocks)-1].Force != rule.Force {
+			blocks = append(blocks, redirectBlock{Force: rule.Force})
+		}
+
+		blocks[len(blocks)-1].Rules = append(blocks[len(blocks)-1].Rules, rule)
+	}
+
+	return blocks
+}
+
+// pathHeaders groups the _headers rules by header name. As a map uses the
+// first regex that matches, the rules are listed in reverse so that a later
+// rule overrides an earlier one for the paths it matches. Security headers that
+// are also set in _headers become the default value of the path header and are
+// removed from the returned security headers.
+func pathHeaders(rules []HeaderRule, security []ResponseHeader) ([]pathHeader, []ResponseHeader) {
+	var headers []pathHeader
+	index := map[string]int{}
+	for _, rule := range rules {
+		for _, header := range rule.Headers {
+			key := strings.ToLower(header.Name)
+			i, ok := index[key]
+			if !ok {
+				i = len(headers)
+				index[key] = i
+				headers = append(headers, pathHeader{
+					Name:     header.Name,
+					Variable: "$headers_" + strings.ReplaceAll(key, "-", "_"),
+				})
+			}
+
+			headers[i].Rules = append([]pathHeaderRule{{Regex: rule.Regex, Value: escapeTemplate(header.Value)}}, headers[i].Rules...)
+		}
+	}
+
+	var remaining []ResponseHeader
+	for _, header := range security {
+		i, ok := index[strings.ToLower(header.Name)]
+		if !ok {
+			remaining = append(remaining, header)
+			continue
+		}
+
+		headers[i].Default = header.Value
+	}
+
+	return headers, remaining
+}
+
+// escapeTemplate keeps the template engine that renders nginx.conf at launch
+// from evaluating '{{' in values written into the generated configuration.
+func escapeTemplate(value string) string {
+	return strings.ReplaceAll(value, "{{", `{{ "{{" }}`)
+}
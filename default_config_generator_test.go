@@ -41,20 +41,22 @@ func testDefaultConfigGenerator(t *testing.T, context spec.G, it spec.S) {
 			})
 			Expect(err).NotTo(HaveOccurred())
 
-			topLevelContext := ContainSubstring(`# Number of worker processes running in container
-worker_processes 1;
+			topLevelContext := ContainSubstring(`# Number of worker processes running in container, one per CPU available to it
+worker_processes {{ cpus }};
 
 # Run NGINX in foreground (necessary for containerized NGINX)
 daemon off;
 
-# Set the location of the server's error log
-error_log stderr;
+# Set the location of the server's error log, and its level with
+# NGINX_ERROR_LOG_LEVEL at launch
+error_log stderr {{ errorLogLevel }};
 
 `)
 
 			eventsContext := ContainSubstring(`events {
-  # Set number of simultaneous connections each worker process can serve
-  worker_connections 1024;
+  # Set number of simultaneous connections each worker process can serve,
+  # within the file descriptor and memory limits of the container
+  worker_connections {{ maxConnections }};
 }
 
 `)
@@ -147,7 +149,13 @@ error_log stderr;
 
 `)
 
-			logToStdOut := ContainSubstring(` access_log /dev/stdout;`)
+			logToStdOut := ContainSubstring(`  {{- $format := accessLogFormat "combined" }}
+  {{- if eq $format "off" }}
+  access_log off;
+  {{- else }}
+  access_log /dev/stdout {{ $format }};
+  {{- end }}
+`)
 
 			defaultResponseMimeType := ContainSubstring(`  default_type application/octet-stream;`)
 
@@ -206,9 +214,27 @@ error_log stderr;
     listen {{port}} default_server;
     server_name _;
 
+    # Terminate TLS using the certificate and key from the 'tls' binding, if
+    # one is provided at launch
+    {{- with tls }}
+    listen 8443 ssl default_server;
+    ssl_certificate {{ .Certificate }};
+    ssl_certificate_key {{ .Key }};
+    ssl_protocols TLSv1.2 TLSv1.3;
+    ssl_session_cache shared:SSL:10m;
+    ssl_session_timeout 10m;
+    {{- end }}
+
     # Directory where static files are located
     root {{ env "APP_ROOT" }}/public;
 
+    # Require username + password authentication for access, if an 'htpasswd'
+    # binding is provided at launch
+    {{- with htpasswd }}
+    auth_basic "Password Protected";
+    auth_basic_user_file {{ . }};
+    {{- end }}
+
     location / {
       # Specify files sent to client if specific file not requested (e.g.
       # GET www.example.com/). NGINX sends first existing file in the list.
@@ -283,6 +309,121 @@ error_log stderr;
 				To(matchers.BeAFileMatching(ContainSubstring(`include ./custom-include.conf;`)))
 		})
 
+		it("writes an nginx.conf that conditionally serves custom error pages", func() {
+			err := generator.Generate(nginx.Configuration{
+				NGINXConfLocation:     filepath.Join(workingDir, "nginx.conf"),
+				WebServerErrorPage404: "404.html",
+				WebServerErrorPage5xx: "errors/../50x.html",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`    location ~ /\.(?!well-known) {
+      deny all;
+      return 404;
+    }
+
+    # Serve custom error pages, which can't be requested directly
+    error_page 404 /404.html;
+    error_page 500 502 503 504 /50x.html;
+
+    location = /404.html {
+      internal;
+    }
+
+    location = /50x.html {
+      internal;
+    }
+  }
+`)))
+			Expect(buffer.String()).To(ContainSubstring("Serving '/404.html' for 404 responses"))
+			Expect(buffer.String()).To(ContainSubstring("Serving '/50x.html' for 5xx responses"))
+		})
+
+		context("when the same page is used for all errors", func() {
+			it("writes a single internal location for it", func() {
+				err := generator.Generate(nginx.Configuration{
+					NGINXConfLocation:     filepath.Join(workingDir, "nginx.conf"),
+					WebServerErrorPage404: "error.html",
+					WebServerErrorPage5xx: "/error.html",
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(filepath.Join(workingDir, "nginx.conf")).
+					To(matchers.BeAFileMatching(ContainSubstring(`    error_page 404 /error.html;
+    error_page 500 502 503 504 /error.html;
+
+    location = /error.html {
+      internal;
+    }
+  }
+`)))
+			})
+		})
+
+		it("writes an nginx.conf that serves the runtime environment file from the runtime directory without caching", func() {
+			err := generator.Generate(nginx.Configuration{
+				NGINXConfLocation:         filepath.Join(workingDir, "nginx.conf"),
+				WebServerRuntimeEnvPrefix: "PUBLIC_",
+				WebServerRuntimeEnvFile:   "env.js",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`    # Serve the environment variables written at launch from the runtime
+    # directory, and don't let clients cache them
+    location = /env.js {
+      alias /tmp/nginx/runtime-env/env.js;
+      expires epoch;
+    }
+  }
+`)))
+			Expect(buffer.String()).To(ContainSubstring("Writing environment variables prefixed with 'PUBLIC_' to '/env.js' at launch"))
+		})
+
+		it("writes an nginx.conf that conditionally serves clean URLs without trailing slashes", func() {
+			err := generator.Generate(nginx.Configuration{
+				NGINXConfLocation:      filepath.Join(workingDir, "nginx.conf"),
+				WebServerCleanURLs:     true,
+				WebServerTrailingSlash: "strip",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`    location / {
+      # Redirect paths with a trailing slash to the same path without it
+      rewrite ^(.+)/$ $1 permanent;
+
+      # Serve e.g. /about from about.html or about/index.html, whichever exists
+      try_files $uri $uri.html $uri/ =404;
+
+      # Specify files sent to client if specific file not requested (e.g.
+`)))
+			Expect(buffer.String()).To(ContainSubstring("Enabling clean URLs"))
+			Expect(buffer.String()).To(ContainSubstring("Redirecting paths with a trailing slash to strip it"))
+		})
+
+		it("writes an nginx.conf that conditionally adds trailing slashes", func() {
+			err := generator.Generate(nginx.Configuration{
+				NGINXConfLocation:        filepath.Join(workingDir, "nginx.conf"),
+				WebServerEnablePushState: true,
+				WebServerTrailingSlash:   "add",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`    location / {
+      # Redirect paths without a file extension to the same path with a
+      # trailing slash
+      rewrite ^(.*/[^/.]+)$ $1/ permanent;
+
+      # Send the content at / in response to any requested endpoint that
+      # doesn't match a file or directory
+      try_files $uri $uri/ /;
+`)))
+			Expect(buffer.String()).To(ContainSubstring("Redirecting paths without a trailing slash to add one"))
+		})
+
 		it("writes an nginx.conf that conditionally includes the PushState content", func() {
 			err := generator.Generate(nginx.Configuration{
 				NGINXConfLocation:        filepath.Join(workingDir, "nginx.conf"),
@@ -292,11 +433,66 @@ error_log stderr;
 
 			Expect(filepath.Join(workingDir, "nginx.conf")).
 				To(matchers.BeAFileMatching(ContainSubstring(`    location / {
-      # Send the content at / in response to *any* requested endpoint
-      if (!-e $request_filename) {
-        rewrite ^(.*)$ / break;
-      }
+      # Send the content at / in response to any requested endpoint that
+      # doesn't match a file or directory
+      try_files $uri $uri/ /;
+
+      # Specify files sent to client if specific file not requested (e.g.
+`)))
+		})
+
+		context("when push state exclusions are set", func() {
+			it("writes an nginx.conf that returns genuine 404s for the excluded requests", func() {
+				err := generator.Generate(nginx.Configuration{
+					NGINXConfLocation:                   filepath.Join(workingDir, "nginx.conf"),
+					WebServerEnablePushState:            true,
+					WebServerPushStateExcludePaths:      nginx.StringList{"/api/", "/static/"},
+					WebServerPushStateExcludeExtensions: nginx.StringList{"js", ".css", "map"},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(filepath.Join(workingDir, "nginx.conf")).
+					To(matchers.BeAFileMatching(ContainSubstring(`    location / {
+      # Send the content at / in response to any requested endpoint that
+      # doesn't match a file or directory
+      try_files $uri $uri/ /;
+
+      # Specify files sent to client if specific file not requested (e.g.
+      # GET www.example.com/). NGINX sends first existing file in the list.
+      index index.html index.htm Default.htm;
+    }
+
+    # (Security) Don't serve dotfiles, except .well-known/, which is needed by
+    # LetsEncrypt
+    location ~ /\.(?!well-known) {
+      deny all;
+      return 404;
+    }
+
+    # Return a genuine 404 for missing files under this prefix instead of the
+    # push state content. The regex locations above still apply to it.
+    location /api/ {
+      try_files $uri $uri/ =404;
+      index index.html index.htm Default.htm;
+    }
+
+    # Return a genuine 404 for missing files under this prefix instead of the
+    # push state content. The regex locations above still apply to it.
+    location /static/ {
+      try_files $uri $uri/ =404;
+      index index.html index.htm Default.htm;
+    }
+
+    # Return a genuine 404 for missing files with these extensions instead of
+    # the push state content
+    location ~* \.(js|css|map)$ {
+      try_files $uri =404;
+    }
+  }
 `)))
+				Expect(buffer.String()).To(ContainSubstring("Excluding paths under '/api/'"))
+				Expect(buffer.String()).To(ContainSubstring("Excluding files with extension js, css, map"))
+			})
 		})
 
 		it("writes an nginx.conf that conditionally includes the Force HTTPS content", func() {
@@ -316,7 +512,13 @@ error_log stderr;
       set $updated_host $http_x_forwarded_host;
     }
 
-    if ($http_x_forwarded_proto != "https") {
+    # Requests to the TLS listener are HTTPS whatever the forwarded headers say
+    set $updated_proto $http_x_forwarded_proto;
+    if ($scheme = "https") {
+      set $updated_proto "https";
+    }
+
+    if ($updated_proto != "https") {
       return 301 https://$updated_host$request_uri;
     }
 `)))
@@ -343,24 +545,653 @@ error_log stderr;
 `)))
 		})
 
-		it("writes an nginx.conf that conditionally includes the Basic Auth content", func() {
+		it("writes an nginx.conf with JSON access logs that skip the excluded paths", func() {
+			err := generator.Generate(nginx.Configuration{
+				NGINXConfLocation:              filepath.Join(workingDir, "nginx.conf"),
+				WebServerAccessLogFormat:       "json",
+				WebServerAccessLogExcludePaths: nginx.StringList{"/healthz", "/ready/"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`  log_format json escape=json '{'
+    '"time":"$time_iso8601",'
+    '"request_id":"$request_id",'
+    '"remote_addr":"$remote_addr",'
+    '"method":"$request_method",'
+    '"uri":"$request_uri",'
+    '"protocol":"$server_protocol",'
+    '"status":$status,'
+    '"body_bytes_sent":$body_bytes_sent,'
+    '"request_time":$request_time,'
+    '"upstream_connect_time":"$upstream_connect_time",'
+    '"upstream_response_time":"$upstream_response_time",'
+    '"http_referer":"$http_referer",'
+    '"http_user_agent":"$http_user_agent"'
+  '}';
+
+  # Skip logging requests under the excluded paths, such as health checks
+  map $uri $access_log_enabled {
+    default 1;
+    "~^/healthz(/|$)" 0;
+    "~^/ready(/|$)" 0;
+  }
+
+  {{- $format := accessLogFormat "json" }}
+  {{- if eq $format "off" }}
+  access_log off;
+  {{- else }}
+  access_log /dev/stdout {{ $format }} if=$access_log_enabled;
+  {{- end }}
+`)))
+
+			Expect(buffer.String()).To(ContainSubstring("Writing access logs in the 'json' format"))
+			Expect(buffer.String()).To(ContainSubstring("Excluding paths under '/healthz' from the access log"))
+		})
+
+		it("writes an nginx.conf with access logs turned off, unless overridden at launch", func() {
+			err := generator.Generate(nginx.Configuration{
+				NGINXConfLocation:        filepath.Join(workingDir, "nginx.conf"),
+				WebServerAccessLogFormat: "off",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`{{- $format := accessLogFormat "off" }}`)))
+			Expect(buffer.String()).To(ContainSubstring("Disabling access logs"))
+		})
+
+		it("writes an nginx.conf that binds stub_status to localhost when the metrics exporter is enabled", func() {
+			err := generator.Generate(nginx.Configuration{
+				NGINXConfLocation:    filepath.Join(workingDir, "nginx.conf"),
+				NGINXStubStatusPort:  "8083",
+				NGINXMetricsExporter: true,
+				WebServerRoot:        "./public",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`  # stub_status
+  server {
+    # Only the metrics exporter reads the status, from within the container
+    listen  127.0.0.1:8083;
+    listen  [::1]:8083;
+
+    location /stub_status {
+      stub_status;
+    }
+  }
+`)))
+		})
+
+		it("writes an nginx.conf that includes the Basic Auth content if an htpasswd binding is provided at launch", func() {
+			err := generator.Generate(nginx.Configuration{
+				NGINXConfLocation: filepath.Join(workingDir, "nginx.conf"),
+				WebServerRoot:     "./public",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`    root {{ env "APP_ROOT" }}/public;
+
+    # Require username + password authentication for access, if an 'htpasswd'
+    # binding is provided at launch
+    {{- with htpasswd }}
+    auth_basic "Password Protected";
+    auth_basic_user_file {{ . }};
+    {{- end }}
+`)))
+		})
+
+		it("writes an nginx.conf that listens for TLS on the specified port if a tls binding is provided at launch", func() {
+			err := generator.Generate(nginx.Configuration{
+				NGINXConfLocation: filepath.Join(workingDir, "nginx.conf"),
+				WebServerTLSPort:  "9443",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`    {{- with tls }}
+    listen 9443 ssl default_server;
+`)))
+		})
+
+		it("writes an nginx.conf that conditionally includes the security headers preset", func() {
+			err := generator.Generate(nginx.Configuration{
+				NGINXConfLocation:        filepath.Join(workingDir, "nginx.conf"),
+				WebServerRoot:            "./public",
+				WebServerSecurityHeaders: true,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`    root {{ env "APP_ROOT" }}/public;
+
+    # (Security) Add security headers to every response
+    add_header Strict-Transport-Security "max-age=31536000; includeSubDomains" always;
+    add_header X-Content-Type-Options "nosniff" always;
+    add_header X-Frame-Options "DENY" always;
+    add_header Referrer-Policy "strict-origin-when-cross-origin" always;
+    add_header Permissions-Policy "camera=(), geolocation=(), microphone=()" always;
+
+    # Require username + password authentication for access, if an 'htpasswd'
+    # binding is provided at launch
+    {{- with htpasswd }}
+    auth_basic "Password Protected";
+    auth_basic_user_file {{ . }};
+    {{- end }}
+
+    location / {
+`)))
+		})
+
+		it("writes an nginx.conf with individually overridden security headers", func() {
+			err := generator.Generate(nginx.Configuration{
+				NGINXConfLocation:                filepath.Join(workingDir, "nginx.conf"),
+				WebServerSecurityHeaders:         true,
+				WebServerStrictTransportSecurity: "max-age=600",
+				WebServerFrameOptions:            "off",
+				WebServerReferrerPolicy:          "off",
+				WebServerPermissionsPolicy:       "off",
+				WebServerContentSecurityPolicy:   `default-src 'self'; report-uri "/csp"`,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`    # (Security) Add security headers to every response
+    add_header Strict-Transport-Security "max-age=600" always;
+    add_header X-Content-Type-Options "nosniff" always;
+    add_header Content-Security-Policy "default-src 'self'; report-uri \"/csp\"" always;
+`)))
+		})
+
+		it("writes an nginx.conf in which '{{' in security header values is not evaluated at launch", func() {
+			err := generator.Generate(nginx.Configuration{
+				NGINXConfLocation:              filepath.Join(workingDir, "nginx.conf"),
+				WebServerContentSecurityPolicy: "default-src {{self}}",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`    add_header Content-Security-Policy "default-src {{ "{{" }}self}}" always;`)))
+		})
+
+		it("writes an nginx.conf with explicitly set security headers when the preset is disabled", func() {
+			err := generator.Generate(nginx.Configuration{
+				NGINXConfLocation:              filepath.Join(workingDir, "nginx.conf"),
+				WebServerContentSecurityPolicy: "default-src 'self'",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(And(
+					ContainSubstring(`    add_header Content-Security-Policy "default-src 'self'" always;`),
+					Not(ContainSubstring("X-Content-Type-Options")),
+				)))
+		})
+
+		it("writes an nginx.conf that conditionally includes the Cache-Control policy", func() {
+			err := generator.Generate(nginx.Configuration{
+				NGINXConfLocation:     filepath.Join(workingDir, "nginx.conf"),
+				WebServerCacheControl: true,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`    location ~ /\.(?!well-known) {
+      deny all;
+      return 404;
+    }
+
+    # (Performance) Let clients cache content-hashed assets for as long as
+    # possible, as their names change whenever their content does
+    location ~* "[.-][0-9a-f]{8,}\.(css|js|mjs|map|json|woff2?|ttf|otf|eot|png|jpe?g|gif|svg|webp|avif|ico)$" {
+      expires 1y;
+      add_header Cache-Control "public, immutable";
+    }
+
+    # Make clients revalidate HTML so that new deployments are picked up
+    location ~* "\.html?$" {
+      expires epoch;
+    }
+  }
+`)))
+		})
+
+		it("writes an nginx.conf with the specified Cache-Control patterns and max-ages", func() {
+			err := generator.Generate(nginx.Configuration{
+				NGINXConfLocation:                filepath.Join(workingDir, "nginx.conf"),
+				WebServerCacheControl:            true,
+				WebServerImmutableAssetsPattern:  `-[A-Za-z0-9_-]{8}\.js$`,
+				WebServerImmutableAssetsMaxAge:   "30d",
+				WebServerHTMLPattern:             `\.(html|json)$`,
+				WebServerHTMLMaxAge:              "5m",
+				WebServerSecurityHeaders:         true,
+				WebServerFrameOptions:            "off",
+				WebServerReferrerPolicy:          "off",
+				WebServerPermissionsPolicy:       "off",
+				WebServerStrictTransportSecurity: "off",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`    location ~* "-[A-Za-z0-9_-]{8}\.js$" {
+      expires 30d;
+      add_header Cache-Control "public, immutable";
+      add_header X-Content-Type-Options "nosniff" always;
+    }
+
+    # Make clients revalidate HTML so that new deployments are picked up
+    location ~* "\.(html|json)$" {
+      expires 5m;
+    }
+`)))
+		})
+
+		it("writes an nginx.conf that escapes template actions in the Cache-Control patterns", func() {
+			err := generator.Generate(nginx.Configuration{
+				NGINXConfLocation:               filepath.Join(workingDir, "nginx.conf"),
+				WebServerCacheControl:           true,
+				WebServerImmutableAssetsPattern: `-{{8}}\.js$`,
+				WebServerHTMLPattern:            `\.{{html}}$`,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`location ~* "-{{ "{{" }}8}}\.js$" {`)))
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`location ~* "\.{{ "{{" }}html}}$" {`)))
+		})
+
+		it("writes an nginx.conf that conditionally includes the _redirects rules", func() {
 			err := generator.Generate(nginx.Configuration{
 				NGINXConfLocation: filepath.Join(workingDir, "nginx.conf"),
 				WebServerRoot:     "./public",
-				BasicAuthFile:     "/some/file/path",
+				WebServerProxyPass: nginx.ProxyRules{
+					{Path: "/api/", Upstream: "http://backend:8080"},
+					{Path: "/v1.0/", Upstream: "http://legacy:8080"},
+				},
+				Redirects: []nginx.RedirectRule{
+					{Regex: `^/news/(?<redirect_splat>.*)$`, Replacement: "/blog/$redirect_splat", Flag: "permanent"},
+					{Regex: `^/home/?$`, Replacement: "/", Flag: "redirect"},
+					{Regex: `^/legacy/?$`, Replacement: "https://example.com/", Flag: "permanent", Force: true},
+					{Regex: `^/(?<redirect_splat>.*)$`, Replacement: "/index.html", Flag: "last"},
+				},
 			})
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(filepath.Join(workingDir, "nginx.conf")).
 				To(matchers.BeAFileMatching(ContainSubstring(`    root {{ env "APP_ROOT" }}/public;
 
-    # Require username + password authentication for access
+    # Require username + password authentication for access, if an 'htpasswd'
+    # binding is provided at launch
+    {{- with htpasswd }}
     auth_basic "Password Protected";
-    auth_basic_user_file /some/file/path;
+    auth_basic_user_file {{ . }};
+    {{- end }}
+
+    # Rules from _redirects, applied in order until one matches
+
+    # Proxied paths skip the rules, keeping their request URI as it is
+    if ($uri ~ "^(?:/api/|/v1\.0/)") {
+      break;
+    }
+    if (!-e $request_filename) {
+      rewrite "^/news/(?<redirect_splat>.*)$" "/blog/$redirect_splat" permanent;
+      rewrite "^/home/?$" "/" redirect;
+    }
+    rewrite "^/legacy/?$" "https://example.com/" permanent;
+    if (!-e $request_filename) {
+      rewrite "^/(?<redirect_splat>.*)$" "/index.html" last;
+    }
+
+    # Proxy requests under this prefix to an upstream server. '^~' keeps the
+    # regex locations below, e.g. for Cache-Control, from serving these paths.
+    location ^~ /api/ {
+`)))
+			Expect(buffer.String()).To(ContainSubstring("Adding 4 rule(s) from _redirects"))
+		})
+
+		it("writes an nginx.conf that keeps encoded request URIs of proxied paths when there are _redirects rules", func() {
+			err := generator.Generate(nginx.Configuration{
+				NGINXConfLocation: filepath.Join(workingDir, "nginx.conf"),
+				WebServerProxyPass: nginx.ProxyRules{
+					{Path: "/api/", Upstream: "http://backend:8080"},
+				},
+				Redirects: []nginx.RedirectRule{
+					{Regex: `^/home/?$`, Replacement: "/", Flag: "redirect"},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// A rewrite to $uri would replace a request URI such as /api/a%2Fb with
+			// the decoded /api/a/b, which proxy_pass then sends upstream
+			content, err := os.ReadFile(filepath.Join(workingDir, "nginx.conf"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).NotTo(ContainSubstring("$uri last;"))
+			Expect(string(content)).To(ContainSubstring(`    if ($uri ~ "^(?:/api/)") {
+      break;
+    }
+    if (!-e $request_filename) {
+      rewrite "^/home/?$" "/" redirect;
+    }`))
+		})
+
+		it("writes an nginx.conf that conditionally adds the _headers rules by request path", func() {
+			err := generator.Generate(nginx.Configuration{
+				NGINXConfLocation:       filepath.Join(workingDir, "nginx.conf"),
+				WebServerRoot:           "./public",
+				WebServerFrameOptions:   "DENY",
+				WebServerCacheControl:   true,
+				WebServerReferrerPolicy: "no-referrer",
+				Headers: []nginx.HeaderRule{
+					{
+						Regex: `^/.*(\?.*)?$`,
+						Headers: []nginx.ResponseHeader{
+							{Name: "X-Robots-Tag", Value: "noindex"},
+						},
+					},
+					{
+						Regex: `^/embed/[^/]+(\?.*)?$`,
+						Headers: []nginx.ResponseHeader{
+							{Name: "x-frame-options", Value: "SAMEORIGIN"},
+							{Name: "X-Robots-Tag", Value: "all"},
+						},
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`  server_tokens off;
+
+  # Select the value of the X-Robots-Tag header from _headers by request path
+  map $request_uri $headers_x_robots_tag {
+    "~^/embed/[^/]+(\?.*)?$" "all";
+    "~^/.*(\?.*)?$" "noindex";
+  }
+
+  # Select the value of the x-frame-options header from _headers by request path
+  map $request_uri $headers_x_frame_options {
+    default "DENY";
+    "~^/embed/[^/]+(\?.*)?$" "SAMEORIGIN";
+  }
+
+  server {
+    listen {{port}} default_server;
+    server_name _;
+
+    # Terminate TLS using the certificate and key from the 'tls' binding, if
+    # one is provided at launch
+    {{- with tls }}
+    listen 8443 ssl default_server;
+    ssl_certificate {{ .Certificate }};
+    ssl_certificate_key {{ .Key }};
+    ssl_protocols TLSv1.2 TLSv1.3;
+    ssl_session_cache shared:SSL:10m;
+    ssl_session_timeout 10m;
+    {{- end }}
+
+    # Directory where static files are located
+    root {{ env "APP_ROOT" }}/public;
+
+    # (Security) Add security headers to every response
+    add_header Referrer-Policy "no-referrer" always;
+
+    # Add the headers from _headers that match the request path
+    add_header X-Robots-Tag $headers_x_robots_tag always;
+    add_header x-frame-options $headers_x_frame_options always;
 `)))
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`    # Don't serve the _redirects and _headers files
+    location ~ ^/_(redirects|headers)$ {
+      deny all;
+      return 404;
+    }
+`)))
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`      add_header Cache-Control "public, immutable";
+      add_header Referrer-Policy "no-referrer" always;
+      add_header X-Robots-Tag $headers_x_robots_tag always;
+      add_header x-frame-options $headers_x_frame_options always;
+    }
+`)))
+			Expect(buffer.String()).To(ContainSubstring("Adding 2 rule(s) from _headers"))
+		})
+
+		it("writes an nginx.conf in which Cache-Control from _headers takes precedence over the caching rules", func() {
+			err := generator.Generate(nginx.Configuration{
+				NGINXConfLocation:     filepath.Join(workingDir, "nginx.conf"),
+				WebServerRoot:         "./public",
+				WebServerCacheControl: true,
+				Headers: []nginx.HeaderRule{
+					{
+						Regex: `^/assets/.*(\?.*)?$`,
+						Headers: []nginx.ResponseHeader{
+							{Name: "Cache-Control", Value: "no-store"},
+						},
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`  # Select the value of the Cache-Control header from _headers by request path
+  map $request_uri $headers_cache_control {
+    "~^/assets/.*(\?.*)?$" "no-store";
+  }
+
+  # Let Cache-Control from _headers take precedence over the caching rules
+  map $headers_cache_control $immutable_assets_expires {
+    "" 1y;
+    default off;
+  }
+
+  map $headers_cache_control $immutable_assets_cache_control {
+    "" "public, immutable";
+    default "";
+  }
+
+  map $headers_cache_control $html_expires {
+    "" epoch;
+    default off;
+  }
+`)))
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`      expires $immutable_assets_expires;
+      add_header Cache-Control $immutable_assets_cache_control;
+      add_header Cache-Control $headers_cache_control always;
+    }
+
+    # Make clients revalidate HTML so that new deployments are picked up
+    location ~* "\.html?$" {
+      expires $html_expires;
+    }
+`)))
+		})
+
+		it("writes an nginx.conf in which '{{' in _headers values is not evaluated at launch", func() {
+			err := generator.Generate(nginx.Configuration{
+				NGINXConfLocation: filepath.Join(workingDir, "nginx.conf"),
+				Headers: []nginx.HeaderRule{
+					{
+						Regex: `^/.*(\?.*)?$`,
+						Headers: []nginx.ResponseHeader{
+							{Name: "X-Template", Value: "{{ port }}"},
+						},
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`    "~^/.*(\?.*)?$" "{{ "{{" }} port }}";`)))
+		})
+
+		it("writes an nginx.conf that conditionally includes reverse proxy locations", func() {
+			err := generator.Generate(nginx.Configuration{
+				NGINXConfLocation: filepath.Join(workingDir, "nginx.conf"),
+				WebServerRoot:     "./public",
+				WebServerProxyPass: nginx.ProxyRules{
+					{Path: "/api/", Upstream: "http://backend:8080"},
+					{Path: "/auth/", Upstream: "https://auth.example.com/v1/"},
+				},
+				WebServerProxyReadTimeout: "120s",
+				WebServerProxySendTimeout: "90s",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(workingDir, "nginx.conf")).
+				To(matchers.BeAFileMatching(ContainSubstring(`    root {{ env "APP_ROOT" }}/public;
+
+    # Require username + password authentication for access, if an 'htpasswd'
+    # binding is provided at launch
+    {{- with htpasswd }}
+    auth_basic "Password Protected";
+    auth_basic_user_file {{ . }};
+    {{- end }}
+
+    # Proxy requests under this prefix to an upstream server. '^~' keeps the
+    # regex locations below, e.g. for Cache-Control, from serving these paths.
+    location ^~ /api/ {
+      proxy_pass http://backend:8080;
+      proxy_http_version 1.1;
+
+      # Forward details of the original request to the upstream server
+      proxy_set_header Host $host;
+      proxy_set_header X-Real-IP $remote_addr;
+      proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+      proxy_set_header X-Forwarded-Host $host;
+      proxy_set_header X-Forwarded-Proto $scheme;
+
+      proxy_connect_timeout 10s;
+      proxy_send_timeout 90s;
+      proxy_read_timeout 120s;
+    }
+
+    # Proxy requests under this prefix to an upstream server. '^~' keeps the
+    # regex locations below, e.g. for Cache-Control, from serving these paths.
+    location ^~ /auth/ {
+      proxy_pass https://auth.example.com/v1/;
+`)))
+			Expect(buffer.String()).To(ContainSubstring("Proxying requests under '/api/' to 'http://backend:8080'"))
 		})
 
 		context("failure cases", func() {
+			context("when a proxy path conflicts with the server location path", func() {
+				it("returns an error", func() {
+					err := generator.Generate(nginx.Configuration{
+						NGINXConfLocation: filepath.Join(workingDir, "nginx.conf"),
+						WebServerProxyPass: nginx.ProxyRules{
+							{Path: "/", Upstream: "http://backend:8080"},
+						},
+					})
+					Expect(err).To(MatchError("proxy path '/' (BP_WEB_SERVER_PROXY_PASS) conflicts with server location path"))
+				})
+			})
+
+			context("when a cache control pattern contains a double quote", func() {
+				it("returns an error", func() {
+					err := generator.Generate(nginx.Configuration{
+						NGINXConfLocation:     filepath.Join(workingDir, "nginx.conf"),
+						WebServerCacheControl: true,
+						WebServerHTMLPattern:  `"\.html$`,
+					})
+					Expect(err).To(MatchError(`cache control pattern '"\.html$' must not contain '"'`))
+				})
+			})
+
+			context("when clean URLs are combined with push state routing", func() {
+				it("returns an error", func() {
+					err := generator.Generate(nginx.Configuration{
+						NGINXConfLocation:        filepath.Join(workingDir, "nginx.conf"),
+						WebServerCleanURLs:       true,
+						WebServerEnablePushState: true,
+					})
+					Expect(err).To(MatchError("clean URLs (BP_WEB_SERVER_CLEAN_URLS) cannot be combined with push state routing (BP_WEB_SERVER_ENABLE_PUSH_STATE)"))
+				})
+			})
+
+			context("when trailing slashes are stripped without clean URLs", func() {
+				it("returns an error", func() {
+					err := generator.Generate(nginx.Configuration{
+						NGINXConfLocation:      filepath.Join(workingDir, "nginx.conf"),
+						WebServerTrailingSlash: "strip",
+					})
+					Expect(err).To(MatchError("stripping trailing slashes (BP_WEB_SERVER_TRAILING_SLASH) requires clean URLs (BP_WEB_SERVER_CLEAN_URLS)"))
+				})
+			})
+
+			context("when a push state exclusion path is outside the server location path", func() {
+				it("returns an error", func() {
+					err := generator.Generate(nginx.Configuration{
+						NGINXConfLocation:              filepath.Join(workingDir, "nginx.conf"),
+						WebServerLocationPath:          "/app",
+						WebServerEnablePushState:       true,
+						WebServerPushStateExcludePaths: nginx.StringList{"/api/"},
+					})
+					Expect(err).To(MatchError("push state exclusion path '/api/' (BP_WEB_SERVER_PUSH_STATE_EXCLUDE_PATHS) must be a path under the server location path '/app'"))
+				})
+			})
+
+			context("when a push state exclusion path is proxied", func() {
+				it("returns an error", func() {
+					err := generator.Generate(nginx.Configuration{
+						NGINXConfLocation:              filepath.Join(workingDir, "nginx.conf"),
+						WebServerEnablePushState:       true,
+						WebServerPushStateExcludePaths: nginx.StringList{"/api/"},
+						WebServerProxyPass: nginx.ProxyRules{
+							{Path: "/api/", Upstream: "http://backend:8080"},
+						},
+					})
+					Expect(err).To(MatchError("push state exclusion path '/api/' (BP_WEB_SERVER_PUSH_STATE_EXCLUDE_PATHS) is already proxied (BP_WEB_SERVER_PROXY_PASS)"))
+				})
+			})
+
+			context("when a push state exclusion extension is invalid", func() {
+				it("returns an error", func() {
+					err := generator.Generate(nginx.Configuration{
+						NGINXConfLocation:                   filepath.Join(workingDir, "nginx.conf"),
+						WebServerEnablePushState:            true,
+						WebServerPushStateExcludeExtensions: nginx.StringList{"js|css"},
+					})
+					Expect(err).To(MatchError("push state exclusion extension 'js|css' (BP_WEB_SERVER_PUSH_STATE_EXCLUDE_EXTENSIONS) is invalid"))
+				})
+			})
+
+			context("when the trailing slash mode is invalid", func() {
+				it("returns an error", func() {
+					err := generator.Generate(nginx.Configuration{
+						NGINXConfLocation:      filepath.Join(workingDir, "nginx.conf"),
+						WebServerTrailingSlash: "keep",
+					})
+					Expect(err).To(MatchError("trailing slash mode 'keep' (BP_WEB_SERVER_TRAILING_SLASH) is invalid, must be one of 'add' or 'strip'"))
+				})
+			})
+
+			context("when the access log format is invalid", func() {
+				it("returns an error", func() {
+					err := generator.Generate(nginx.Configuration{
+						NGINXConfLocation:        filepath.Join(workingDir, "nginx.conf"),
+						WebServerAccessLogFormat: "xml",
+					})
+					Expect(err).To(MatchError("access log format 'xml' (BP_WEB_SERVER_ACCESS_LOG_FORMAT) is invalid, must be one of 'combined', 'json' or 'off'"))
+				})
+			})
+
+			context("when an access log exclusion path is invalid", func() {
+				it("returns an error", func() {
+					err := generator.Generate(nginx.Configuration{
+						NGINXConfLocation:              filepath.Join(workingDir, "nginx.conf"),
+						WebServerAccessLogExcludePaths: nginx.StringList{"healthz"},
+					})
+					Expect(err).To(MatchError("access log exclusion path 'healthz' (BP_WEB_SERVER_ACCESS_LOG_EXCLUDE_PATHS) must be a path starting with '/'"))
+				})
+			})
+
 			context("destination file already exists and it's read-only", func() {
 				it.Before(func() {
 					Expect(os.WriteFile(filepath.Join(workingDir, "nginx.conf"), []byte("read-only file"), 0444)).To(Succeed())
@@ -0,0 +1,37 @@
+package fakes
+
+import (
+	"sync"
+
+	"github.com/paketo-buildpacks/nginx"
+)
+
+type Precompressor struct {
+	PrecompressCall struct {
+		mutex     sync.Mutex
+		CallCount int
+		Receives  struct {
+			Root      string
+			CachePath string
+			Brotli    bool
+		}
+		Returns struct {
+			PrecompressResult nginx.PrecompressResult
+			Error             error
+		}
+		Stub func(string, string, bool) (nginx.PrecompressResult, error)
+	}
+}
+
+func (f *Precompressor) Precompress(param1 string, param2 string, param3 bool) (nginx.PrecompressResult, error) {
+	f.PrecompressCall.mutex.Lock()
+	defer f.PrecompressCall.mutex.Unlock()
+	f.PrecompressCall.CallCount++
+	f.PrecompressCall.Receives.Root = param1
+	f.PrecompressCall.Receives.CachePath = param2
+	f.PrecompressCall.Receives.Brotli = param3
+	if f.PrecompressCall.Stub != nil {
+		return f.PrecompressCall.Stub(param1, param2, param3)
+	}
+	return f.PrecompressCall.Returns.PrecompressResult, f.PrecompressCall.Returns.Error
+}
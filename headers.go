@@ -0,0 +1,128 @@
+package nginx
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const HeadersFile = "_headers"
+
+// HeaderRule is a rule from a Netlify-style _headers file: the response
+// headers to add to requests whose path matches Regex.
+type HeaderRule struct {
+	Regex   string
+	Headers []ResponseHeader
+}
+
+var headerNameRegexp = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// ParseHeaders parses the rules of a _headers file. Each rule starts with an
+// unindented path pattern followed by indented "Name: value" lines, e.g.
+//
+//	/*
+//	  X-Frame-Options: DENY
+//	/assets/*
+//	  Cache-Control: public, max-age=31536000
+//
+// Patterns support a trailing '*' and ':placeholder' segments. Errors carry
+// the line number.
+func ParseHeaders(name string, r io.Reader) ([]HeaderRule, error) {
+	var rules []HeaderRule
+
+	scanner := bufio.NewScanner(r)
+	for number := 1; scanner.Scan(); number++ {
+		text := scanner.Text()
+		line := strings.TrimSpace(text)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if text[0] != ' ' && text[0] != '\t' {
+			regex, err := headerPathRegex(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", name, number, err)
+			}
+
+			rules = append(rules, HeaderRule{Regex: regex})
+			continue
+		}
+
+		if len(rules) == 0 {
+			return nil, fmt.Errorf("%s:%d: header '%s' must follow a path", name, number, line)
+		}
+
+		header, err := parseHeader(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, number, err)
+		}
+
+		rules[len(rules)-1].Headers = append(rules[len(rules)-1].Headers, header)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	return rules, nil
+}
+
+func headerPathRegex(path string) (string, error) {
+	if !strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("path '%s' must start with '/', domain-level headers are not supported", path)
+	}
+
+	segments := strings.Split(path, "/")[1:]
+
+	var regex strings.Builder
+	regex.WriteString("^")
+	for i, segment := range segments {
+		regex.WriteString("/")
+
+		switch {
+		case segment == "*" && i == len(segments)-1:
+			regex.WriteString(".*")
+		case placeholderRegexp.MatchString(segment):
+			regex.WriteString("[^/]+")
+		case strings.ContainsAny(segment, "*\"' \t"):
+			return "", fmt.Errorf("path '%s' contains unsupported characters", path)
+		default:
+			regex.WriteString(regexp.QuoteMeta(segment))
+		}
+	}
+
+	// Patterns are matched against the request URI, which includes the query
+	// string
+	regex.WriteString(`(\?.*)?$`)
+
+	return regex.String(), nil
+}
+
+func parseHeader(line string) (ResponseHeader, error) {
+	if strings.HasPrefix(line, "!") {
+		return ResponseHeader{}, fmt.Errorf("removing headers with '%s' is not supported", line)
+	}
+
+	name, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return ResponseHeader{}, fmt.Errorf("header '%s' must have the format 'Name: value'", line)
+	}
+
+	name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+	if !headerNameRegexp.MatchString(name) {
+		return ResponseHeader{}, fmt.Errorf("header name '%s' is invalid", name)
+	}
+
+	if value == "" {
+		return ResponseHeader{}, fmt.Errorf("header '%s' has no value", name)
+	}
+
+	if strings.Contains(value, "$") {
+		return ResponseHeader{}, errors.New("header values containing '$' are not supported")
+	}
+
+	return ResponseHeader{Name: name, Value: strings.ReplaceAll(value, `"`, `\"`)}, nil
+}
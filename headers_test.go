@@ -0,0 +1,69 @@
+package nginx_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/paketo-buildpacks/nginx"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testHeaders(t *testing.T, context spec.G, it spec.S) {
+	var Expect = NewWithT(t).Expect
+
+	context("ParseHeaders", func() {
+		it("translates the path patterns into regular expressions", func() {
+			rules, err := nginx.ParseHeaders("_headers", strings.NewReader(`
+# Headers for every page
+/*
+  X-Frame-Options: DENY
+  Link: </style.css>; rel="preload"
+
+/embed/:id/frame.html
+	X-Frame-Options:SAMEORIGIN
+`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rules).To(Equal([]nginx.HeaderRule{
+				{
+					Regex: `^/.*(\?.*)?$`,
+					Headers: []nginx.ResponseHeader{
+						{Name: "X-Frame-Options", Value: "DENY"},
+						{Name: "Link", Value: `</style.css>; rel=\"preload\"`},
+					},
+				},
+				{
+					Regex: `^/embed/[^/]+/frame\.html(\?.*)?$`,
+					Headers: []nginx.ResponseHeader{
+						{Name: "X-Frame-Options", Value: "SAMEORIGIN"},
+					},
+				},
+			}))
+		})
+
+		context("failure cases", func() {
+			for _, example := range []struct {
+				rule    string
+				line    int
+				message string
+			}{
+				{"  X-Frame-Options: DENY", 3, "header 'X-Frame-Options: DENY' must follow a path"},
+				{"https://example.com/*\n  X-Frame-Options: DENY", 3, "path 'https://example.com/*' must start with '/', domain-level headers are not supported"},
+				{"/*/docs", 3, "path '/*/docs' contains unsupported characters"},
+				{"/\n  X-Frame-Options DENY", 4, "header 'X-Frame-Options DENY' must have the format 'Name: value'"},
+				{"/\n  X Frame: DENY", 4, "header name 'X Frame' is invalid"},
+				{"/\n  X-Frame-Options:", 4, "header 'X-Frame-Options' has no value"},
+				{"/\n  ! X-Frame-Options", 4, "removing headers with '! X-Frame-Options' is not supported"},
+				{"/\n  X-Host: $host", 4, "header values containing '$' are not supported"},
+			} {
+				example := example
+				it("returns an error with the line number for "+example.rule, func() {
+					_, err := nginx.ParseHeaders("public/_headers", strings.NewReader("# first line\n\n"+example.rule))
+					Expect(err).To(MatchError(fmt.Sprintf("public/_headers:%d: %s", example.line, example.message)))
+				})
+			}
+		})
+	})
+}
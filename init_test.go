@@ -15,6 +15,10 @@ func TestUnitNGINX(t *testing.T) {
 	suite("Configuration", testConfiguration)
 	suite("DefaultConfigGenerator", testDefaultConfigGenerator)
 	suite("Detect", testDetect)
+	suite("Headers", testHeaders)
+	suite("LintConfig", testLintConfig)
 	suite("Parse", testParser)
+	suite("Precompressor", testPrecompressor)
+	suite("Redirects", testRedirects)
 	suite.Run(t)
 }
@@ -195,10 +195,8 @@ func testNoConfApp(t *testing.T, context spec.G, it spec.S) {
 			image, logs, err = pack.Build.
 				WithBuildpacks(settings.Buildpacks.NGINX.Online).
 				WithEnv(map[string]string{
-					"BP_WEB_SERVER":        "nginx",
-					"SERVICE_BINDING_ROOT": "/bindings",
+					"BP_WEB_SERVER": "nginx",
 				}).
-				WithVolumes(fmt.Sprintf("%s:/bindings/auth", filepath.Join(source, "binding"))).
 				WithPullPolicy("never").
 				Execute(name, filepath.Join(source, "app"))
 			Expect(err).NotTo(HaveOccurred())
@@ -207,11 +205,13 @@ func testNoConfApp(t *testing.T, context spec.G, it spec.S) {
 				"  Generating /workspace/nginx.conf",
 				`    Setting server root directory to '{{ env "APP_ROOT" }}/public'`,
 				"    Setting server location path to '/'",
-				`    Enabling basic authentication with .htpasswd credentials`,
 			))
 
 			container, err = docker.Container.Run.
-				WithEnv(map[string]string{"PORT": "8080"}).
+				WithEnv(map[string]string{
+					"PORT":                 "8080",
+					"SERVICE_BINDING_ROOT": "/bindings",
+				}).
 				WithVolumes(fmt.Sprintf("%s:/bindings/auth", filepath.Join(source, "binding"))).
 				WithPublish("8080").
 				Execute(image.ID)
@@ -245,6 +245,10 @@ func testNoConfApp(t *testing.T, context spec.G, it spec.S) {
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(string(contents)).To(ContainSubstring("Hello World!"))
+
+			logs, err = docker.Container.Logs.Execute(container.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(logs).To(ContainSubstring("Enabling basic authentication with the 'htpasswd' binding auth"))
 		})
 	})
 
@@ -0,0 +1,143 @@
+package nginx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/paketo-buildpacks/nginx/nginxconf"
+)
+
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+// LintFinding is a problem with a directive of the nginx configuration that
+// keeps it from working as expected in a container.
+type LintFinding struct {
+	File     string
+	Line     int
+	Severity string
+	Message  string
+}
+
+func (f LintFinding) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s", f.File, f.Line, f.Severity, f.Message)
+}
+
+var tempPathDirectives = []string{
+	"client_body_temp_path",
+	"proxy_temp_path",
+	"fastcgi_temp_path",
+	"uwsgi_temp_path",
+	"scgi_temp_path",
+}
+
+// LintConfig checks the directives of the given configuration files for
+// settings that break nginx in a container. Relative paths resolve against
+// prefix, and load_module paths within skipDir, which is populated later in
+// the build, aren't checked. Arguments containing template actions are only
+// known at launch and are skipped.
+func LintConfig(confs []nginxconf.File, prefix, skipDir string) []LintFinding {
+	var findings []LintFinding
+	var listens []nginxconf.Directive
+	usesPort := false
+
+	var walk func(directives []nginxconf.Directive)
+	walk = func(directives []nginxconf.Directive) {
+		for _, d := range directives {
+			finding := func(severity, format string, a ...interface{}) {
+				findings = append(findings, LintFinding{File: d.File, Line: d.Line, Severity: severity, Message: fmt.Sprintf(format, a...)})
+			}
+
+			switch d.Name {
+			case "daemon":
+				if len(d.Args) == 1 && d.Args[0] == "on" {
+					finding(LintError, "'daemon on' sends nginx to the background, which stops the container; remove it or use 'daemon off'")
+				}
+
+			case "pid":
+				finding(LintError, "'pid' conflicts with the pid file set on the command line; remove it")
+
+			case "user":
+				finding(LintWarning, "'user' has no effect, as nginx doesn't run as root; remove it")
+
+			case "listen":
+				if len(d.Args) > 0 && !strings.HasPrefix(d.Args[0], "unix:") {
+					if isPortTemplate(d.Args[0]) {
+						usesPort = true
+					} else {
+						listens = append(listens, d)
+					}
+				}
+
+			case "load_module":
+				if len(d.Args) == 1 && !strings.Contains(d.Args[0], "{{") {
+					path := d.Args[0]
+					if !filepath.IsAbs(path) {
+						path = filepath.Join(prefix, path)
+					}
+
+					if !within(skipDir, path) {
+						if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+							finding(LintError, "module %s doesn't exist; use {{module \"<name>\"}} to load modules of the buildpack or the app", d.Args[0])
+						}
+					}
+				}
+			}
+
+			for _, name := range tempPathDirectives {
+				if d.Name == name && len(d.Args) > 0 && !writable(d.Args[0]) {
+					finding(LintWarning, "'%s' points outside of the writable directories; use a path under {{tempDir}}", d.Name)
+				}
+			}
+
+			walk(d.Block)
+		}
+	}
+
+	for _, conf := range confs {
+		walk(conf.Directives)
+	}
+
+	if !usesPort {
+		for _, d := range listens {
+			findings = append(findings, LintFinding{
+				File:     d.File,
+				Line:     d.Line,
+				Severity: LintWarning,
+				Message:  fmt.Sprintf("'listen %s' ignores $PORT, as no server listens on {{port}}", d.Args[0]),
+			})
+		}
+	}
+
+	return findings
+}
+
+func isPortTemplate(arg string) bool {
+	for _, port := range []string{"{{port}}", "{{ port }}", `{{env "PORT"}}`, `{{ env "PORT" }}`} {
+		if strings.Contains(arg, port) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writable reports whether nginx can write to path at launch: relative paths
+// resolve within the runtime directory, which is under /tmp as well.
+func writable(path string) bool {
+	return strings.Contains(path, "{{") || !filepath.IsAbs(path) || within("/tmp", path)
+}
+
+func within(dir, path string) bool {
+	if dir == "" {
+		return false
+	}
+
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
@@ -0,0 +1,85 @@
+package nginx_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paketo-buildpacks/nginx"
+	"github.com/paketo-buildpacks/nginx/nginxconf"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testLintConfig(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		prefix    string
+		layersDir string
+	)
+
+	it.Before(func() {
+		prefix = t.TempDir()
+		layersDir = t.TempDir()
+
+		Expect(os.MkdirAll(filepath.Join(prefix, "modules"), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(prefix, "modules", "ngx_app_module.so"), nil, 0600)).To(Succeed())
+	})
+
+	lint := func(content string) []nginx.LintFinding {
+		directives, err := nginxconf.Parse("nginx.conf", []byte(content))
+		Expect(err).NotTo(HaveOccurred())
+
+		return nginx.LintConfig([]nginxconf.File{{Path: "nginx.conf", Directives: directives}}, prefix, layersDir)
+	}
+
+	it("accepts a configuration made for containers", func() {
+		Expect(lint(`daemon off;
+{{module "ngx_stream_module"}}
+load_module modules/ngx_app_module.so;
+load_module ` + filepath.Join(layersDir, "nginx", "modules", "ngx_http_module.so") + `;
+http {
+  client_body_temp_path {{ tempDir }}/client_body_temp;
+  proxy_temp_path /tmp/proxy_temp;
+  fastcgi_temp_path fastcgi_temp;
+  server {
+    listen {{port}} default_server;
+    listen unix:/tmp/nginx.sock;
+  }
+  server {
+    listen 8083;
+  }
+}`)).To(BeEmpty())
+	})
+
+	it("reports the directives that break in containers", func() {
+		Expect(lint(`daemon on;
+user nginx;
+pid /var/run/nginx.pid;
+load_module /usr/lib/nginx/modules/ngx_missing_module.so;
+http {
+  client_body_temp_path /var/cache/nginx/client_body_temp;
+  server {
+    listen 80;
+  }
+  server {
+    listen {{ env "OTHER_PORT" }};
+  }
+}`)).To(Equal([]nginx.LintFinding{
+			{File: "nginx.conf", Line: 1, Severity: nginx.LintError, Message: "'daemon on' sends nginx to the background, which stops the container; remove it or use 'daemon off'"},
+			{File: "nginx.conf", Line: 2, Severity: nginx.LintWarning, Message: "'user' has no effect, as nginx doesn't run as root; remove it"},
+			{File: "nginx.conf", Line: 3, Severity: nginx.LintError, Message: "'pid' conflicts with the pid file set on the command line; remove it"},
+			{File: "nginx.conf", Line: 4, Severity: nginx.LintError, Message: `module /usr/lib/nginx/modules/ngx_missing_module.so doesn't exist; use {{module "<name>"}} to load modules of the buildpack or the app`},
+			{File: "nginx.conf", Line: 6, Severity: nginx.LintWarning, Message: "'client_body_temp_path' points outside of the writable directories; use a path under {{tempDir}}"},
+			{File: "nginx.conf", Line: 8, Severity: nginx.LintWarning, Message: "'listen 80' ignores $PORT, as no server listens on {{port}}"},
+			{File: "nginx.conf", Line: 11, Severity: nginx.LintWarning, Message: `'listen {{ env "OTHER_PORT" }}' ignores $PORT, as no server listens on {{port}}`},
+		}))
+	})
+
+	it("formats findings with their location", func() {
+		finding := nginx.LintFinding{File: "nginx.conf", Line: 3, Severity: nginx.LintError, Message: "some-message"}
+		Expect(finding.String()).To(Equal("nginx.conf:3: error: some-message"))
+	})
+}
@@ -0,0 +1,131 @@
+package nginxconf
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// File is a configuration file along with its parsed directives.
+type File struct {
+	Path       string
+	Content    []byte
+	Directives []Directive
+}
+
+// Resolve loads and parses the configuration file at path along with every
+// file it includes, directly or through other included files, main file first.
+// Relative include paths resolve against prefix, as nginx resolves them
+// against the directory of its main configuration file rather than that of
+// the including file. Paths containing template actions are skipped, as are
+// globs matching no files. Each file is loaded once, through load, which lets
+// callers render templates before the includes are looked up.
+func Resolve(path, prefix string, load func(path string) ([]byte, error)) ([]File, error) {
+	var files []File
+	seen := map[string]bool{}
+
+	var visit func(path string) error
+	visit = func(path string) error {
+		if seen[path] {
+			return nil
+		}
+		seen[path] = true
+
+		content, err := load(path)
+		if err != nil {
+			return fmt.Errorf("could not read config file (%s): %w", path, err)
+		}
+
+		directives, err := Parse(path, content)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, File{Path: path, Content: content, Directives: directives})
+
+		for _, include := range Includes(directives) {
+			glob := include.Args[0]
+			if strings.Contains(glob, "{{") {
+				continue
+			}
+
+			if !filepath.IsAbs(glob) {
+				glob = filepath.Join(prefix, glob)
+			}
+
+			matches, err := filepath.Glob(glob)
+			if err != nil {
+				return fmt.Errorf("failed to get 'include' files for %s: %w", glob, err)
+			}
+
+			for _, match := range matches {
+				err = visit(match)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	err := visit(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+var includeConfRegexp = regexp.MustCompile(`include\s+(\S*.conf);`)
+
+// ResolveByName loads the configuration file at path along with the .conf
+// files its include directives name, without parsing them. It is the fallback
+// for configurations that Resolve can't parse, such as those with Lua blocks,
+// which nginx still accepts. Relative include paths resolve against prefix.
+func ResolveByName(path, prefix string, load func(path string) ([]byte, error)) ([]File, error) {
+	content, err := load(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file (%s): %w", path, err)
+	}
+
+	files := []File{{Path: path, Content: content}}
+	for _, match := range includeConfRegexp.FindAllStringSubmatch(string(content), -1) {
+		glob := match[1]
+		if !filepath.IsAbs(glob) {
+			glob = filepath.Join(prefix, glob)
+		}
+
+		matches, err := filepath.Glob(glob)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get 'include' files for %s: %w", glob, err)
+		}
+
+		for _, match := range matches {
+			content, err := load(match)
+			if err != nil {
+				return nil, fmt.Errorf("could not read config file (%s): %w", match, err)
+			}
+
+			files = append(files, File{Path: match, Content: content})
+		}
+	}
+
+	return files, nil
+}
+
+// Includes returns the include directives among directives and their blocks,
+// in order.
+func Includes(directives []Directive) []Directive {
+	var includes []Directive
+	for _, directive := range directives {
+		if directive.Name == "include" && len(directive.Args) == 1 {
+			includes = append(includes, directive)
+		}
+
+		includes = append(includes, Includes(directive.Block)...)
+	}
+
+	return includes
+}
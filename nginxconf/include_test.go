@@ -0,0 +1,145 @@
+package nginxconf_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paketo-buildpacks/nginx/nginxconf"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testResolve(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		dir      string
+		mainConf string
+	)
+
+	it.Before(func() {
+		dir = t.TempDir()
+		mainConf = filepath.Join(dir, "nginx.conf")
+
+		Expect(os.MkdirAll(filepath.Join(dir, "conf.d"), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(mainConf, []byte(`http {
+  include mime.types;
+  # include commented.conf;
+  include "conf.d/*";
+  include {{ env "EXTRA" }};
+}`), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "mime.types"), []byte("types {}"), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "commented.conf"), nil, 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "conf.d", "a.conf"), []byte("server { include conf.d/b.conf; include missing/*.conf; }"), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "conf.d", "b.conf"), []byte(fmt.Sprintf("include %s;", mainConf)), 0600)).To(Succeed())
+	})
+
+	it("returns the main file and every file it includes, relative to the prefix", func() {
+		files, err := nginxconf.Resolve(mainConf, dir, os.ReadFile)
+		Expect(err).NotTo(HaveOccurred())
+
+		var paths []string
+		for _, file := range files {
+			paths = append(paths, file.Path)
+		}
+
+		Expect(paths).To(Equal([]string{
+			mainConf,
+			filepath.Join(dir, "mime.types"),
+			filepath.Join(dir, "conf.d", "a.conf"),
+			filepath.Join(dir, "conf.d", "b.conf"),
+		}))
+		Expect(files[1].Content).To(Equal([]byte("types {}")))
+		Expect(files[1].Directives).To(HaveLen(1))
+	})
+
+	it("looks up the includes of the loaded content", func() {
+		files, err := nginxconf.Resolve(mainConf, dir, func(path string) ([]byte, error) {
+			content, err := os.ReadFile(path)
+			return bytes.ReplaceAll(content, []byte(`{{ env "EXTRA" }}`), []byte("commented.conf")), err
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(HaveLen(5))
+		Expect(files[4].Path).To(Equal(filepath.Join(dir, "commented.conf")))
+	})
+
+	context("failure cases", func() {
+		context("when a file can't be loaded", func() {
+			it("returns an error", func() {
+				_, err := nginxconf.Resolve(filepath.Join(dir, "no-such.conf"), dir, os.ReadFile)
+				Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf("could not read config file (%s)", filepath.Join(dir, "no-such.conf")))))
+			})
+		})
+
+		context("when an included file can't be parsed", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(dir, "mime.types"), []byte("types {"), 0600)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := nginxconf.Resolve(mainConf, dir, os.ReadFile)
+				Expect(err).To(MatchError(fmt.Sprintf(`%s:1: unexpected end of file, expecting "}"`, filepath.Join(dir, "mime.types"))))
+			})
+		})
+
+		context("when an include is not a valid glob", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(mainConf, []byte(`include \/\/.conf;`), 0600)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := nginxconf.Resolve(mainConf, dir, os.ReadFile)
+				Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf("failed to get 'include' files for %s", dir))))
+			})
+		})
+	})
+}
+
+func testResolveByName(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		dir      string
+		mainConf string
+	)
+
+	it.Before(func() {
+		dir = t.TempDir()
+		mainConf = filepath.Join(dir, "nginx.conf")
+
+		Expect(os.MkdirAll(filepath.Join(dir, "conf.d"), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(mainConf, []byte(`http {
+  include conf.d/*.conf;
+  server {
+    location / {
+      content_by_lua_block { ngx.say("}") }
+    }
+  }
+}`), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "conf.d", "a.conf"), []byte("server {}"), 0600)).To(Succeed())
+	})
+
+	it("returns the main file and the .conf files it includes, without parsing them", func() {
+		files, err := nginxconf.ResolveByName(mainConf, dir, os.ReadFile)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(files).To(HaveLen(2))
+		Expect(files[0].Path).To(Equal(mainConf))
+		Expect(files[0].Directives).To(BeNil())
+		Expect(files[1].Path).To(Equal(filepath.Join(dir, "conf.d", "a.conf")))
+		Expect(files[1].Content).To(Equal([]byte("server {}")))
+	})
+
+	context("failure cases", func() {
+		context("when a file can't be loaded", func() {
+			it("returns an error", func() {
+				_, err := nginxconf.ResolveByName(filepath.Join(dir, "no-such.conf"), dir, os.ReadFile)
+				Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf("could not read config file (%s)", filepath.Join(dir, "no-such.conf")))))
+			})
+		})
+	})
+}
@@ -0,0 +1,19 @@
+package nginxconf_test
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega/format"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitNGINXConf(t *testing.T) {
+	format.MaxLength = 0
+	suite := spec.New("nginxconf", spec.Report(report.Terminal{}))
+	suite("Modules", testModules)
+	suite("Parse", testParse)
+	suite("Resolve", testResolve)
+	suite("ResolveByName", testResolveByName)
+	suite.Run(t)
+}
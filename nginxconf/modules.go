@@ -0,0 +1,81 @@
+package nginxconf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Modules returns the names of the dynamic modules, the .so files, in dirs,
+// sorted and without duplicates. Directories that don't exist are skipped.
+func Modules(dirs ...string) ([]string, error) {
+	modules := []string{}
+	seen := map[string]bool{}
+
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return nil, fmt.Errorf("failed to list modules in %s: %w", dir, err)
+		}
+
+		for _, entry := range entries {
+			name, ok := strings.CutSuffix(entry.Name(), ".so")
+			if !ok || entry.IsDir() || seen[name] {
+				continue
+			}
+
+			seen[name] = true
+			modules = append(modules, name)
+		}
+	}
+
+	sort.Strings(modules)
+
+	return modules, nil
+}
+
+// ModulePath returns the path of the named module in the first of dirs that
+// has it. The error for a missing module lists the available ones.
+func ModulePath(name string, dirs ...string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid module name %q", name)
+	}
+
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+
+		path := filepath.Join(dir, name+".so")
+		_, err := os.Stat(path)
+		if err == nil {
+			return path, nil
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("failed to look up module %q: %w", name, err)
+		}
+	}
+
+	available, err := Modules(dirs...)
+	if err != nil {
+		return "", err
+	}
+
+	if len(available) == 0 {
+		return "", fmt.Errorf("module %q not found, no modules are available", name)
+	}
+
+	return "", fmt.Errorf("module %q not found, available modules: %s", name, strings.Join(available, ", "))
+}
@@ -0,0 +1,68 @@
+package nginxconf_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paketo-buildpacks/nginx/nginxconf"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testModules(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		localDir  string
+		globalDir string
+	)
+
+	it.Before(func() {
+		localDir = t.TempDir()
+		globalDir = t.TempDir()
+
+		Expect(os.WriteFile(filepath.Join(localDir, "ngx_foo_module.so"), nil, 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(localDir, "README.md"), nil, 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(globalDir, "ngx_stream_module.so"), nil, 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(globalDir, "ngx_foo_module.so"), nil, 0600)).To(Succeed())
+	})
+
+	context("Modules", func() {
+		it("lists the modules of all directories", func() {
+			modules, err := nginxconf.Modules(localDir, "", filepath.Join(localDir, "missing"), globalDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(modules).To(Equal([]string{"ngx_foo_module", "ngx_stream_module"}))
+		})
+	})
+
+	context("ModulePath", func() {
+		it("returns the path in the first directory that has the module", func() {
+			path, err := nginxconf.ModulePath("ngx_foo_module", localDir, globalDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(path).To(Equal(filepath.Join(localDir, "ngx_foo_module.so")))
+
+			path, err = nginxconf.ModulePath("ngx_stream_module", "", localDir, globalDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(path).To(Equal(filepath.Join(globalDir, "ngx_stream_module.so")))
+		})
+
+		context("failure cases", func() {
+			it("lists the available modules when the module doesn't exist", func() {
+				_, err := nginxconf.ModulePath("ngx_steam_module", localDir, globalDir)
+				Expect(err).To(MatchError(`module "ngx_steam_module" not found, available modules: ngx_foo_module, ngx_stream_module`))
+			})
+
+			it("says so when there are no modules at all", func() {
+				_, err := nginxconf.ModulePath("ngx_stream_module", t.TempDir())
+				Expect(err).To(MatchError(`module "ngx_stream_module" not found, no modules are available`))
+			})
+
+			it("rejects names that are paths", func() {
+				_, err := nginxconf.ModulePath("../ngx_foo_module", localDir)
+				Expect(err).To(MatchError(`invalid module name "../ngx_foo_module"`))
+			})
+		})
+	})
+}
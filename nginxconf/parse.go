@@ -0,0 +1,350 @@
+// Package nginxconf parses nginx configuration files into their directives
+// and resolves the files they include.
+package nginxconf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Directive is a simple directive, such as "listen 8080;", or a block
+// directive, such as "server { ... }", whose directives are in Block.
+//
+// Template actions, such as {{port}}, are kept verbatim within names and
+// arguments. An action starting a statement, such as {{module "name"}}, is a
+// directive of its own without arguments, as it renders to whole statements.
+type Directive struct {
+	Name string
+	Args []string
+	// Spans holds the byte ranges of Args in the source, including any quotes,
+	// so that they can be rewritten in place
+	Spans []Span
+	File  string
+	Line  int
+	Block []Directive
+	// IsBlock is set for block directives, even when their block is empty
+	IsBlock bool
+}
+
+// Span is a byte range [Start, End) of a source.
+type Span struct {
+	Start int
+	End   int
+}
+
+// Template reports whether the directive is a template action on its own.
+func (d Directive) Template() bool {
+	return isAction(d.Name)
+}
+
+// ParseError is a syntax error at a line of a configuration file.
+type ParseError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Parse parses the directives of the nginx configuration in content. Errors
+// are a *ParseError carrying the name and the line number.
+func Parse(name string, content []byte) ([]Directive, error) {
+	p := parser{name: name, lexer: lexer{src: content, line: 1}}
+
+	directives, err := p.parse(false)
+	if err != nil {
+		return nil, &ParseError{File: name, Line: p.lexer.line, Err: err}
+	}
+
+	return directives, nil
+}
+
+type parser struct {
+	name  string
+	lexer lexer
+}
+
+func (p *parser) parse(inBlock bool) ([]Directive, error) {
+	var directives []Directive
+
+	var current *Directive
+	for {
+		tok, err := p.lexer.next()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok.kind {
+		case tokenEOF:
+			if current != nil {
+				return nil, fmt.Errorf("unexpected end of file, expecting \";\" or \"}\"")
+			}
+
+			if inBlock {
+				return nil, fmt.Errorf("unexpected end of file, expecting \"}\"")
+			}
+
+			return directives, nil
+
+		case tokenSemicolon:
+			if current == nil {
+				return nil, fmt.Errorf("unexpected \";\"")
+			}
+
+			directives = append(directives, *current)
+			current = nil
+
+		case tokenOpenBrace:
+			if current == nil {
+				return nil, fmt.Errorf("unexpected \"{\"")
+			}
+
+			block, err := p.parse(true)
+			if err != nil {
+				return nil, err
+			}
+
+			current.Block = block
+			current.IsBlock = true
+			directives = append(directives, *current)
+			current = nil
+
+		case tokenCloseBrace:
+			if current != nil {
+				return nil, fmt.Errorf("unexpected \"}\"")
+			}
+
+			if !inBlock {
+				return nil, fmt.Errorf("unexpected \"}\"")
+			}
+
+			return directives, nil
+
+		case tokenWord:
+			if current == nil {
+				if !tok.quoted && isAction(tok.value) {
+					directives = append(directives, Directive{Name: tok.value, File: p.name, Line: tok.line})
+					continue
+				}
+
+				current = &Directive{Name: tok.value, File: p.name, Line: tok.line}
+				continue
+			}
+
+			current.Args = append(current.Args, tok.value)
+			current.Spans = append(current.Spans, Span{Start: tok.start, End: tok.end})
+		}
+	}
+}
+
+// isAction reports whether s consists of a single template action.
+func isAction(s string) bool {
+	return strings.HasPrefix(s, "{{") && strings.HasSuffix(s, "}}") && strings.Index(s, "}}") == len(s)-2
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenSemicolon
+	tokenOpenBrace
+	tokenCloseBrace
+)
+
+type token struct {
+	kind   tokenKind
+	value  string
+	quoted bool
+	line   int
+	start  int
+	end    int
+}
+
+// lexer splits nginx configuration into tokens the way nginx does: words are
+// separated by whitespace, ";", "{" and "}", may be quoted with ' or ", and "#"
+// starts a comment at the start of a word. Template actions and ${variable}
+// references are kept within words.
+type lexer struct {
+	src  []byte
+	pos  int
+	line int
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+
+		case c == ';':
+			l.pos++
+			return token{kind: tokenSemicolon, line: l.line}, nil
+
+		case c == '{' && !l.at("{{"):
+			l.pos++
+			return token{kind: tokenOpenBrace, line: l.line}, nil
+
+		case c == '}':
+			l.pos++
+			return token{kind: tokenCloseBrace, line: l.line}, nil
+
+		case c == '"' || c == '\'':
+			return l.quoted(c)
+
+		default:
+			return l.word()
+		}
+	}
+
+	return token{kind: tokenEOF, line: l.line}, nil
+}
+
+func (l *lexer) at(s string) bool {
+	return strings.HasPrefix(string(l.src[l.pos:]), s)
+}
+
+func (l *lexer) quoted(quote byte) (token, error) {
+	tok := token{kind: tokenWord, quoted: true, line: l.line, start: l.pos}
+	l.pos++
+
+	var value strings.Builder
+	for {
+		if l.pos >= len(l.src) {
+			l.line = tok.line
+			return token{}, fmt.Errorf("unterminated quoted string")
+		}
+
+		c := l.src[l.pos]
+		switch {
+		case c == quote:
+			l.pos++
+			tok.value = value.String()
+			tok.end = l.pos
+			return tok, nil
+
+		case c == '\\' && l.pos+1 < len(l.src):
+			if l.src[l.pos+1] == '\n' {
+				l.line++
+			}
+			value.WriteString(unescape(l.src[l.pos+1]))
+			l.pos += 2
+
+		case l.at("{{"):
+			action, err := l.action()
+			if err != nil {
+				return token{}, err
+			}
+			value.WriteString(action)
+
+		default:
+			if c == '\n' {
+				l.line++
+			}
+			value.WriteByte(c)
+			l.pos++
+		}
+	}
+}
+
+func (l *lexer) word() (token, error) {
+	tok := token{kind: tokenWord, line: l.line, start: l.pos}
+
+	var value strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == ';' || c == '}':
+			tok.value = value.String()
+			tok.end = l.pos
+			return tok, nil
+
+		case c == '{' && !l.at("{{"):
+			// "${" starts a variable name rather than a block
+			if l.pos > tok.start && l.src[l.pos-1] == '$' {
+				end := strings.IndexByte(string(l.src[l.pos:]), '}')
+				if end < 0 {
+					return token{}, fmt.Errorf("unterminated variable name")
+				}
+
+				value.Write(l.src[l.pos : l.pos+end+1])
+				l.pos += end + 1
+				continue
+			}
+
+			tok.value = value.String()
+			tok.end = l.pos
+			return tok, nil
+
+		case c == '\\' && l.pos+1 < len(l.src):
+			if l.src[l.pos+1] == '\n' {
+				l.line++
+			}
+			value.WriteString(unescape(l.src[l.pos+1]))
+			l.pos += 2
+
+		case l.at("{{"):
+			action, err := l.action()
+			if err != nil {
+				return token{}, err
+			}
+			value.WriteString(action)
+
+		default:
+			value.WriteByte(c)
+			l.pos++
+		}
+	}
+
+	tok.value = value.String()
+	tok.end = l.pos
+	return tok, nil
+}
+
+// action consumes a template action, which may contain quotes, braces and
+// semicolons of its own.
+func (l *lexer) action() (string, error) {
+	end := strings.Index(string(l.src[l.pos:]), "}}")
+	if end < 0 {
+		return "", fmt.Errorf("unterminated template action")
+	}
+
+	action := string(l.src[l.pos : l.pos+end+2])
+	l.line += strings.Count(action, "\n")
+	l.pos += end + 2
+
+	return action, nil
+}
+
+// unescape resolves the escape sequences nginx supports, keeping the backslash
+// of any other sequence.
+func unescape(c byte) string {
+	switch c {
+	case '"', '\'', '\\':
+		return string(c)
+	case 't':
+		return "\t"
+	case 'r':
+		return "\r"
+	case 'n':
+		return "\n"
+	default:
+		return "\\" + string(c)
+	}
+}
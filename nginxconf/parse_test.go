@@ -0,0 +1,109 @@
+package nginxconf_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/paketo-buildpacks/nginx/nginxconf"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testParse(t *testing.T, context spec.G, it spec.S) {
+	var Expect = NewWithT(t).Expect
+
+	it("parses simple and block directives with their lines", func() {
+		directives, err := nginxconf.Parse("nginx.conf", []byte(`# Number of worker processes
+worker_processes 1;
+
+http {
+  include mime.types; # trailing comment
+  server {
+    listen 8080 default_server;
+  }
+  types {}
+}
+`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(directives).To(Equal([]nginxconf.Directive{
+			{Name: "worker_processes", Args: []string{"1"}, Spans: []nginxconf.Span{{Start: 46, End: 47}}, File: "nginx.conf", Line: 2},
+			{
+				Name: "http", File: "nginx.conf", Line: 4, IsBlock: true,
+				Block: []nginxconf.Directive{
+					{Name: "include", Args: []string{"mime.types"}, Spans: []nginxconf.Span{{Start: 67, End: 77}}, File: "nginx.conf", Line: 5},
+					{
+						Name: "server", File: "nginx.conf", Line: 6, IsBlock: true,
+						Block: []nginxconf.Directive{
+							{Name: "listen", Args: []string{"8080", "default_server"}, Spans: []nginxconf.Span{{Start: 120, End: 124}, {Start: 125, End: 139}}, File: "nginx.conf", Line: 7},
+						},
+					},
+					{Name: "types", File: "nginx.conf", Line: 9, IsBlock: true},
+				},
+			},
+		}))
+	})
+
+	it("unquotes arguments and keeps variables and comments within words", func() {
+		directives, err := nginxconf.Parse("nginx.conf", []byte(`add_header X-Note "it's \"quoted\"; {really}" 'single # quoted';
+set $path ${uri}#fragment;
+rewrite ^/a\.b$ /c;`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(directives).To(HaveLen(3))
+		Expect(directives[0].Args).To(Equal([]string{"X-Note", `it's "quoted"; {really}`, "single # quoted"}))
+		Expect(directives[1].Args).To(Equal([]string{"$path", "${uri}#fragment"}))
+		Expect(directives[2].Args).To(Equal([]string{`^/a\.b$`, "/c"}))
+	})
+
+	it("keeps template actions within words and as directives of their own", func() {
+		directives, err := nginxconf.Parse("nginx.conf", []byte(`{{module "ngx_stream_module"}}
+http {
+  listen {{port}};
+  root "{{ env "APP_ROOT" }}/public";
+  {{ if eq (env "GZIP") "on" }}
+  gzip on;
+  {{ end }}
+}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(directives).To(HaveLen(2))
+		Expect(directives[0].Name).To(Equal(`{{module "ngx_stream_module"}}`))
+		Expect(directives[0].Template()).To(BeTrue())
+
+		block := directives[1].Block
+		Expect(block).To(HaveLen(5))
+		Expect(block[0].Args).To(Equal([]string{"{{port}}"}))
+		Expect(block[1].Args).To(Equal([]string{`{{ env "APP_ROOT" }}/public`}))
+		Expect(block[2].Template()).To(BeTrue())
+		Expect(block[3].Name).To(Equal("gzip"))
+		Expect(block[3].Args).To(Equal([]string{"on"}))
+		Expect(block[4].Template()).To(BeTrue())
+		Expect(block[4].Line).To(Equal(7))
+	})
+
+	context("failure cases", func() {
+		for _, example := range []struct {
+			content string
+			message string
+		}{
+			{"worker_processes 1", `nginx.conf:1: unexpected end of file, expecting ";" or "}"`},
+			{"http {\n  gzip on;\n", `nginx.conf:3: unexpected end of file, expecting "}"`},
+			{"http {\n}\n}", `nginx.conf:3: unexpected "}"`},
+			{"gzip on;\n;", `nginx.conf:2: unexpected ";"`},
+			{"{\n}", `nginx.conf:1: unexpected "{"`},
+			{"gzip on;\nreturn 200 \"text;\n", `nginx.conf:2: unterminated quoted string`},
+			{"listen {{port;", `nginx.conf:1: unterminated template action`},
+			{"set $a ${uri;", `nginx.conf:1: unterminated variable name`},
+		} {
+			example := example
+
+			it("returns an error for "+example.content, func() {
+				_, err := nginxconf.Parse("nginx.conf", []byte(example.content))
+				Expect(err).To(MatchError(example.message))
+
+				var parseErr *nginxconf.ParseError
+				Expect(errors.As(err, &parseErr)).To(BeTrue())
+				Expect(parseErr.File).To(Equal("nginx.conf"))
+			})
+		}
+	})
+}
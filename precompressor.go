@@ -0,0 +1,198 @@
+package nginx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// PrecompressMinLength matches the gzip_min_length of the default
+// configuration; smaller files are not worth compressing.
+const PrecompressMinLength = 1100
+
+// PrecompressExtensions lists the extensions of files that are precompressed.
+// It mirrors the gzip_types of the default configuration.
+var PrecompressExtensions = []string{
+	".css", ".eot", ".htm", ".html", ".js", ".json", ".map", ".mjs", ".otf",
+	".svg", ".ttf", ".txt", ".wasm", ".xml",
+}
+
+type PrecompressResult struct {
+	Compressed int
+	Reused     int
+}
+
+type encoding struct {
+	extension string
+	compress  func(w io.Writer, content []byte) error
+}
+
+var (
+	gzipEncoding = encoding{
+		extension: ".gz",
+		compress: func(w io.Writer, content []byte) error {
+			zw, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+			if err != nil {
+				return err
+			}
+
+			_, err = zw.Write(content)
+			if err != nil {
+				return err
+			}
+
+			return zw.Close()
+		},
+	}
+
+	brotliEncoding = encoding{
+		extension: ".br",
+		compress: func(w io.Writer, content []byte) error {
+			bw := brotli.NewWriterLevel(w, brotli.BestCompression)
+			_, err := bw.Write(content)
+			if err != nil {
+				return err
+			}
+
+			return bw.Close()
+		},
+	}
+)
+
+type AssetPrecompressor struct{}
+
+func NewAssetPrecompressor() AssetPrecompressor {
+	return AssetPrecompressor{}
+}
+
+// Precompress writes a .gz (and, if enabled, a .br) sibling next to every
+// compressible file under root, unless one already exists. Compressed content
+// is cached in cachePath keyed by the checksum of the original file, so that
+// unchanged files are not compressed again on rebuild. Cache entries that were
+// not used are removed.
+func (p AssetPrecompressor) Precompress(root, cachePath string, brotliEnabled bool) (PrecompressResult, error) {
+	encodings := []encoding{gzipEncoding}
+	if brotliEnabled {
+		encodings = append(encodings, brotliEncoding)
+	}
+
+	err := os.MkdirAll(cachePath, os.ModePerm)
+	if err != nil {
+		return PrecompressResult{}, fmt.Errorf("failed to create precompression cache: %w", err)
+	}
+
+	var result PrecompressResult
+	used := map[string]bool{}
+	err = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.Type().IsRegular() || !isCompressible(path) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		if info.Size() < PrecompressMinLength {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(content)
+		checksum := hex.EncodeToString(sum[:])
+
+		for _, enc := range encodings {
+			sibling := path + enc.extension
+			if _, err := os.Stat(sibling); err == nil {
+				continue
+			}
+
+			cached := filepath.Join(cachePath, checksum+enc.extension)
+			used[cached] = true
+
+			compressed, err := os.ReadFile(cached)
+			switch {
+			case err == nil:
+				result.Reused++
+			case errors.Is(err, os.ErrNotExist):
+				buffer := bytes.NewBuffer(nil)
+				err = enc.compress(buffer, content)
+				if err != nil {
+					return fmt.Errorf("failed to compress %s: %w", path, err)
+				}
+
+				compressed = buffer.Bytes()
+				err = os.WriteFile(cached, compressed, 0600)
+				if err != nil {
+					return err
+				}
+
+				result.Compressed++
+			default:
+				return err
+			}
+
+			// Serving a compressed file that is larger than the original would
+			// only waste bandwidth
+			if len(compressed) >= len(content) {
+				continue
+			}
+
+			err = os.WriteFile(sibling, compressed, info.Mode().Perm())
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return PrecompressResult{}, fmt.Errorf("failed to precompress assets in %s: %w", root, err)
+	}
+
+	entries, err := os.ReadDir(cachePath)
+	if err != nil {
+		return PrecompressResult{}, fmt.Errorf("failed to read precompression cache: %w", err)
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(cachePath, entry.Name())
+		if !used[path] {
+			err = os.RemoveAll(path)
+			if err != nil {
+				return PrecompressResult{}, fmt.Errorf("failed to prune precompression cache: %w", err)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func isCompressible(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range PrecompressExtensions {
+		if ext == e {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,129 @@
+package nginx_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/paketo-buildpacks/nginx"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testPrecompressor(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		root          string
+		cachePath     string
+		content       string
+		precompressor nginx.AssetPrecompressor
+	)
+
+	it.Before(func() {
+		root = t.TempDir()
+		cachePath = filepath.Join(t.TempDir(), "cache")
+
+		content = strings.Repeat("body { color: red; }\n", 100)
+		Expect(os.MkdirAll(filepath.Join(root, "css"), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(root, "css", "app.css"), []byte(content), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(root, "index.html"), []byte("<html></html>"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(root, "logo.png"), []byte(content), 0644)).To(Succeed())
+
+		precompressor = nginx.NewAssetPrecompressor()
+	})
+
+	context("Precompress", func() {
+		it("writes gzip siblings for compressible files above the minimum length", func() {
+			result, err := precompressor.Precompress(root, cachePath, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(nginx.PrecompressResult{Compressed: 1}))
+
+			file, err := os.Open(filepath.Join(root, "css", "app.css.gz"))
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(file.Close()).To(Succeed()) }()
+
+			reader, err := gzip.NewReader(file)
+			Expect(err).NotTo(HaveOccurred())
+
+			decompressed, err := io.ReadAll(reader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(decompressed)).To(Equal(content))
+
+			Expect(filepath.Join(root, "css", "app.css.br")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(root, "index.html.gz")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(root, "logo.png.gz")).NotTo(BeAnExistingFile())
+		})
+
+		context("when brotli is enabled", func() {
+			it("also writes brotli siblings", func() {
+				result, err := precompressor.Precompress(root, cachePath, true)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(Equal(nginx.PrecompressResult{Compressed: 2}))
+
+				compressed, err := os.ReadFile(filepath.Join(root, "css", "app.css.br"))
+				Expect(err).NotTo(HaveOccurred())
+
+				decompressed, err := io.ReadAll(brotli.NewReader(bytes.NewReader(compressed)))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(decompressed)).To(Equal(content))
+			})
+		})
+
+		context("when the files have been compressed by a previous build", func() {
+			it.Before(func() {
+				_, err := precompressor.Precompress(t.TempDir(), cachePath, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				previous := t.TempDir()
+				Expect(os.WriteFile(filepath.Join(previous, "app.css"), []byte(content), 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(previous, "old.js"), []byte(strings.Repeat("var a = 1;\n", 200)), 0644)).To(Succeed())
+
+				_, err = precompressor.Precompress(previous, cachePath, false)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			it("reuses the cached output for unchanged files and prunes the rest", func() {
+				result, err := precompressor.Precompress(root, cachePath, false)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(Equal(nginx.PrecompressResult{Reused: 1}))
+				Expect(filepath.Join(root, "css", "app.css.gz")).To(BeAnExistingFile())
+
+				entries, err := os.ReadDir(cachePath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entries).To(HaveLen(1))
+			})
+		})
+
+		context("when a compressed sibling is already provided", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(root, "css", "app.css.gz"), []byte("provided"), 0644)).To(Succeed())
+			})
+
+			it("leaves it untouched", func() {
+				result, err := precompressor.Precompress(root, cachePath, false)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(Equal(nginx.PrecompressResult{}))
+
+				contents, err := os.ReadFile(filepath.Join(root, "css", "app.css.gz"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal("provided"))
+			})
+		})
+
+		context("failure cases", func() {
+			context("when the root does not exist", func() {
+				it("returns an error", func() {
+					_, err := precompressor.Precompress(filepath.Join(root, "missing"), cachePath, false)
+					Expect(err).To(MatchError(ContainSubstring("failed to precompress assets in")))
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,178 @@
+package nginx
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const RedirectsFile = "_redirects"
+
+// RedirectRule is a rule from a Netlify-style _redirects file, translated into
+// the arguments of an nginx rewrite directive.
+type RedirectRule struct {
+	Regex       string
+	Replacement string
+	Flag        string
+
+	// Force applies the rule even when the requested path matches an existing
+	// file, as requested by a trailing '!' on the status code.
+	Force bool
+}
+
+var (
+	placeholderRegexp            = regexp.MustCompile(`^:([A-Za-z_][A-Za-z0-9_]*)$`)
+	destinationPlaceholderRegexp = regexp.MustCompile(`:[A-Za-z_][A-Za-z0-9_]*`)
+)
+
+// captureVariablePrefix prefixes the names of the regex captures, which become
+// nginx variables, so that placeholders like :host or :uri don't refer to the
+// built-in variables of the same name.
+const captureVariablePrefix = "redirect_"
+
+// ParseRedirects parses the rules of a _redirects file. Each line holds a
+// source path, a destination and an optional status code, e.g.
+//
+//	/news/*              /blog/:splat    301
+//	/articles/:year/:id  /posts/:id
+//	/*                   /index.html     200
+//
+// Rules that cannot be expressed with rewrite directives, such as proxying to
+// another domain or conditions on country or role, return an error that
+// carries the line number.
+func ParseRedirects(name string, r io.Reader) ([]RedirectRule, error) {
+	var rules []RedirectRule
+
+	scanner := bufio.NewScanner(r)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule, err := parseRedirectRule(strings.Fields(line))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, number, err)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	return rules, nil
+}
+
+func parseRedirectRule(fields []string) (RedirectRule, error) {
+	if len(fields) < 2 {
+		return RedirectRule{}, errors.New("rule must have a source path and a destination")
+	}
+
+	from, to := fields[0], fields[1]
+	if strings.Contains(to, "=") && !strings.HasPrefix(to, "/") && !strings.Contains(to, "://") {
+		return RedirectRule{}, fmt.Errorf("query parameter matching '%s' is not supported", to)
+	}
+
+	if !strings.HasPrefix(from, "/") {
+		return RedirectRule{}, fmt.Errorf("source '%s' must be a path starting with '/', domain-level redirects are not supported", from)
+	}
+
+	status, force := "301", false
+	if len(fields) > 2 {
+		status = fields[2]
+		if strings.HasSuffix(status, "!") {
+			status, force = strings.TrimSuffix(status, "!"), true
+		}
+	}
+
+	if len(fields) > 3 {
+		return RedirectRule{}, fmt.Errorf("conditions '%s' are not supported", strings.Join(fields[3:], " "))
+	}
+
+	var flag string
+	switch status {
+	case "301":
+		flag = "permanent"
+	case "302":
+		flag = "redirect"
+	case "200":
+		if !strings.HasPrefix(to, "/") {
+			return RedirectRule{}, fmt.Errorf("proxying to '%s' is not supported, use BP_WEB_SERVER_PROXY_PASS instead", to)
+		}
+		flag = "last"
+	default:
+		return RedirectRule{}, fmt.Errorf("status code '%s' is not supported, must be one of 200, 301 or 302", fields[2])
+	}
+
+	captures := map[string]bool{}
+	var regex strings.Builder
+	regex.WriteString("^")
+	for i, segment := range strings.Split(from, "/")[1:] {
+		regex.WriteString("/")
+
+		if segment == "*" {
+			if i != strings.Count(from, "/")-1 {
+				return RedirectRule{}, errors.New("splat '*' is only supported at the end of the source path")
+			}
+
+			regex.WriteString("(?<" + captureVariablePrefix + "splat>.*)")
+			captures["splat"] = true
+			continue
+		}
+
+		if match := placeholderRegexp.FindStringSubmatch(segment); match != nil {
+			if captures[match[1]] {
+				return RedirectRule{}, fmt.Errorf("placeholder ':%s' is used more than once", match[1])
+			}
+
+			regex.WriteString(fmt.Sprintf("(?<%s%s>[^/]+)", captureVariablePrefix, match[1]))
+			captures[match[1]] = true
+			continue
+		}
+
+		if strings.ContainsAny(segment, `*"'`) {
+			return RedirectRule{}, fmt.Errorf("source '%s' contains unsupported characters", from)
+		}
+
+		regex.WriteString(regexp.QuoteMeta(segment))
+	}
+
+	// Like Netlify, match the source path with or without a trailing slash
+	if !strings.HasSuffix(from, "/") && !captures["splat"] {
+		regex.WriteString("/?")
+	}
+	regex.WriteString("$")
+
+	// The destination is written into a quoted argument of the rewrite
+	// directive, in which '$' would start a variable
+	if strings.ContainsAny(to, `"';{}$\`) {
+		return RedirectRule{}, fmt.Errorf("destination '%s' contains unsupported characters", to)
+	}
+
+	var unknown string
+	replacement := destinationPlaceholderRegexp.ReplaceAllStringFunc(to, func(placeholder string) string {
+		if !captures[placeholder[1:]] {
+			if unknown == "" {
+				unknown = placeholder
+			}
+			return placeholder
+		}
+
+		return "$" + captureVariablePrefix + placeholder[1:]
+	})
+	if unknown != "" {
+		return RedirectRule{}, fmt.Errorf("destination uses placeholder '%s' that is not in the source path", unknown)
+	}
+
+	return RedirectRule{
+		Regex:       regex.String(),
+		Replacement: replacement,
+		Flag:        flag,
+		Force:       force,
+	}, nil
+}
@@ -0,0 +1,79 @@
+package nginx_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/paketo-buildpacks/nginx"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testRedirects(t *testing.T, context spec.G, it spec.S) {
+	var Expect = NewWithT(t).Expect
+
+	context("ParseRedirects", func() {
+		it("translates the rules into rewrite directive arguments", func() {
+			rules, err := nginx.ParseRedirects("_redirects", strings.NewReader(`
+# Redirect with a 301
+/home              /
+
+/news/*            /blog/:splat
+/articles/:year/:id /posts/:year-:id.html   302
+/legacy            https://example.com/new  301!
+/docs/             /documentation/          302
+/*                 /index.html              200
+`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rules).To(Equal([]nginx.RedirectRule{
+				{Regex: `^/home/?$`, Replacement: "/", Flag: "permanent"},
+				{Regex: `^/news/(?<redirect_splat>.*)$`, Replacement: "/blog/$redirect_splat", Flag: "permanent"},
+				{Regex: `^/articles/(?<redirect_year>[^/]+)/(?<redirect_id>[^/]+)/?$`, Replacement: "/posts/$redirect_year-$redirect_id.html", Flag: "redirect"},
+				{Regex: `^/legacy/?$`, Replacement: "https://example.com/new", Flag: "permanent", Force: true},
+				{Regex: `^/docs/$`, Replacement: "/documentation/", Flag: "redirect"},
+				{Regex: `^/(?<redirect_splat>.*)$`, Replacement: "/index.html", Flag: "last"},
+			}))
+		})
+
+		it("prefixes the capture variables so that placeholders don't refer to nginx variables", func() {
+			rules, err := nginx.ParseRedirects("_redirects", strings.NewReader(`/sites/:host/:uri /:host/:uri`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rules).To(Equal([]nginx.RedirectRule{
+				{Regex: `^/sites/(?<redirect_host>[^/]+)/(?<redirect_uri>[^/]+)/?$`, Replacement: "/$redirect_host/$redirect_uri", Flag: "permanent"},
+			}))
+		})
+
+		it("escapes regular expression characters in the source path", func() {
+			rules, err := nginx.ParseRedirects("_redirects", strings.NewReader(`/old.html /new.html`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rules).To(Equal([]nginx.RedirectRule{
+				{Regex: `^/old\.html/?$`, Replacement: "/new.html", Flag: "permanent"},
+			}))
+		})
+
+		context("failure cases", func() {
+			for _, example := range []struct{ rule, message string }{
+				{"/lonely", "rule must have a source path and a destination"},
+				{"/store id=:id /blog/:id 301", "query parameter matching 'id=:id' is not supported"},
+				{"https://old.example.com/* https://new.example.com/:splat 301!", "source 'https://old.example.com/*' must be a path starting with '/', domain-level redirects are not supported"},
+				{"/gone /404.html 404", "status code '404' is not supported, must be one of 200, 301 or 302"},
+				{"/ /fr 302 Language=fr", "conditions 'Language=fr' are not supported"},
+				{"/api/* https://api.example.com/:splat 200", "proxying to 'https://api.example.com/:splat' is not supported, use BP_WEB_SERVER_PROXY_PASS instead"},
+				{"/*/docs /docs 301", "splat '*' is only supported at the end of the source path"},
+				{"/:a/:a /x 301", "placeholder ':a' is used more than once"},
+				{"/posts/:id /blog/:slug", "destination uses placeholder ':slug' that is not in the source path"},
+				{"/old /new;return", "destination '/new;return' contains unsupported characters"},
+				{"/old /new{}", "destination '/new{}' contains unsupported characters"},
+				{"/old /$host", "destination '/$host' contains unsupported characters"},
+			} {
+				example := example
+
+				it("returns an error with the line number for "+example.rule, func() {
+					_, err := nginx.ParseRedirects("public/_redirects", strings.NewReader("# first line\n\n"+example.rule))
+					Expect(err).To(MatchError("public/_redirects:3: " + example.message))
+				})
+			}
+		})
+	})
+}
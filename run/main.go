@@ -12,7 +12,6 @@ import (
 	"github.com/paketo-buildpacks/packit/v2/postal"
 	"github.com/paketo-buildpacks/packit/v2/sbom"
 	"github.com/paketo-buildpacks/packit/v2/scribe"
-	"github.com/paketo-buildpacks/packit/v2/servicebindings"
 )
 
 type Generator struct{}
@@ -24,7 +23,7 @@ func (f Generator) GenerateFromDependency(dependency postal.Dependency, path str
 func main() {
 	logger := scribe.NewEmitter(os.Stdout).WithLevel(os.Getenv("BP_LOG_LEVEL"))
 
-	config, err := nginx.LoadConfiguration(os.Environ(), servicebindings.NewResolver(), os.Getenv("CNB_PLATFORM_DIR"))
+	config, err := nginx.LoadConfiguration(os.Environ())
 	if err != nil {
 		fmt.Fprintln(os.Stderr, fmt.Errorf("failed to parse build configuration: %w", err))
 		os.Exit(1)
@@ -38,6 +37,7 @@ func main() {
 			nginx.NewDefaultConfigGenerator(logger),
 			fs.NewChecksumCalculator(),
 			Generator{},
+			nginx.NewAssetPrecompressor(),
 			logger,
 			chronos.DefaultClock,
 		),